@@ -0,0 +1,307 @@
+// Package boltstore keeps ASP.NET Identity users in an embedded bbolt database,
+// for programs that have no SQL server. Its Store follows the rules of aspnetusers.Store,
+// as the SQL table does, so the operations of package aspnetusers work with either.
+//
+// Each user is held as JSON, keyed by ID, with indexes on NormalizedUserName (unique)
+// and NormalizedEmail. Users can be moved to or from an SQL aspnetusers table
+// with aspnetusers.Copy, keeping their IDs and stamps, so a program can start with
+// a Store and later share a database with an ASP.NET Core application.
+package boltstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/forsyth/aspnetusers"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	usersBucket  = []byte("users")  // ID to JSON form of user
+	namesBucket  = []byte("names")  // nameKey(NormalizedUserName) to ID
+	emailsBucket = []byte("emails") // NormalizedEmail, 0, ID to nothing
+)
+
+// Store keeps users of type T (User, or a type that embeds it) in a bbolt database.
+// It is safe for concurrent use.
+type Store[T any, P aspnetusers.UserType[T]] struct {
+	db *bolt.DB
+}
+
+// Users is a Store of plain aspnetusers.Users.
+type Users = Store[aspnetusers.User, *aspnetusers.User]
+
+var _ aspnetusers.UserStore = (*Users)(nil)
+
+// New returns a Store that keeps users in the given bbolt database, creating its buckets if need be.
+func New[T any, P aspnetusers.UserType[T]](db *bolt.DB) (*Store[T, P], error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{usersBucket, namesBucket, emailsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("boltstore: %v", err)
+	}
+	return &Store[T, P]{db: db}, nil
+}
+
+// Open opens the bbolt database file, creating it if need be, and returns a Store using it.
+// Close the Store when done.
+func Open[T any, P aspnetusers.UserType[T]](path string) (*Store[T, P], error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("boltstore: %v", err)
+	}
+	s, err := New[T, P](db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the underlying database.
+func (s *Store[T, P]) Close() error {
+	return s.db.Close()
+}
+
+// nameKey returns the key in the names bucket for a NormalizedUserName.
+// An empty name, which bbolt cannot have as a key, is a single 0 byte instead, so that it is unique
+// as it is in the SQL table, where it is an empty string too.
+func nameKey(name string) []byte {
+	if name == "" {
+		return []byte{0}
+	}
+	return []byte(name)
+}
+
+func emailKey(email string, id string) []byte {
+	return append(append([]byte(email), 0), id...)
+}
+
+// get returns the user with the given ID, or nil.
+func (s *Store[T, P]) get(tx *bolt.Tx, id string) (P, error) {
+	data := tx.Bucket(usersBucket).Get([]byte(id))
+	if data == nil {
+		return nil, nil
+	}
+	u := P(new(T))
+	if err := json.Unmarshal(data, u); err != nil {
+		return nil, fmt.Errorf("boltstore: user %s: %v", id, err)
+	}
+	return u, nil
+}
+
+// put stores u and indexes it, replacing any previous index entries for old.
+// It stores a copy of u with LockoutEnd in UTC, as the SQL store keeps it, leaving u itself alone.
+// A user with an empty NormalizedEmail is not in that index.
+func (s *Store[T, P]) put(tx *bolt.Tx, u P, old P) error {
+	nu := P(new(T))
+	*nu = *u
+	iu := nu.IdentityUser()
+	if iu.LockoutEnd != nil {
+		end := iu.LockoutEnd.UTC()
+		iu.LockoutEnd = &end
+	}
+	data, err := json.Marshal(nu)
+	if err != nil {
+		return err
+	}
+	names, emails := tx.Bucket(namesBucket), tx.Bucket(emailsBucket)
+	if old != nil {
+		if err := unindex(tx, old.IdentityUser()); err != nil {
+			return err
+		}
+	}
+	if err := tx.Bucket(usersBucket).Put([]byte(iu.ID), data); err != nil {
+		return err
+	}
+	if err := names.Put(nameKey(iu.NormalizedUserName), []byte(iu.ID)); err != nil {
+		return err
+	}
+	if iu.NormalizedEmail != "" {
+		if err := emails.Put(emailKey(iu.NormalizedEmail, iu.ID), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindex removes the index entries for iu.
+func unindex(tx *bolt.Tx, iu *aspnetusers.User) error {
+	if err := tx.Bucket(namesBucket).Delete(nameKey(iu.NormalizedUserName)); err != nil {
+		return err
+	}
+	if iu.NormalizedEmail != "" {
+		if err := tx.Bucket(emailsBucket).Delete(emailKey(iu.NormalizedEmail, iu.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindByID returns the user with the given ID, or exactly aspnetusers.ErrNotFound.
+func (s *Store[T, P]) FindByID(id string) (P, error) {
+	var u P
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		u, err = s.get(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, aspnetusers.ErrNotFound
+	}
+	return u, nil
+}
+
+// FindByName returns the user with the given user name, compared in normalised form,
+// or exactly aspnetusers.ErrNotFound.
+func (s *Store[T, P]) FindByName(name string) (P, error) {
+	var u P
+	err := s.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(namesBucket).Get(nameKey(aspnetusers.Normalize(name)))
+		if id == nil {
+			return nil
+		}
+		var err error
+		u, err = s.get(tx, string(id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, aspnetusers.ErrNotFound
+	}
+	return u, nil
+}
+
+// UsersByEmail returns the users with the given email address, compared in normalised form, in order of ID.
+// Unlike user names, email addresses need not be unique.
+func (s *Store[T, P]) UsersByEmail(email string) ([]P, error) {
+	var users []P
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := emailKey(aspnetusers.Normalize(email), "")
+		c := tx.Bucket(emailsBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			u, err := s.get(tx, string(k[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			if u != nil {
+				users = append(users, u)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// FindByEmail returns the one user with the given email address, compared in normalised form,
+// or exactly aspnetusers.ErrNotFound or aspnetusers.ErrAmbiguous.
+func (s *Store[T, P]) FindByEmail(email string) (P, error) {
+	return aspnetusers.FindByEmail[P](s, email)
+}
+
+// Create adds a new user, returning exactly aspnetusers.ErrExists if its NormalizedUserName or ID
+// is already registered. An empty ID is set to a new UUID.
+func (s *Store[T, P]) Create(u P) error {
+	iu := u.IdentityUser()
+	id := iu.ID
+	if id == "" {
+		id = uuid.New().String()
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(namesBucket).Get(nameKey(iu.NormalizedUserName)) != nil {
+			return aspnetusers.ErrExists
+		}
+		if tx.Bucket(usersBucket).Get([]byte(id)) != nil {
+			return aspnetusers.ErrExists
+		}
+		iu.ID = id
+		return s.put(tx, u, nil)
+	})
+	if err != nil && err != aspnetusers.ErrExists {
+		return fmt.Errorf("boltstore: adding new user: %v", err)
+	}
+	return err
+}
+
+// Update replaces the user with u's ID, provided its ConcurrencyStamp matches u's,
+// and gives u a new ConcurrencyStamp. Otherwise it returns exactly aspnetusers.ErrConcurrency,
+// or aspnetusers.ErrExists if u's NormalizedUserName belongs to another user,
+// or aspnetusers.ErrNotNormalized if aspnetusers.CheckNormalized fails.
+func (s *Store[T, P]) Update(u P) error {
+	iu := u.IdentityUser()
+	if err := aspnetusers.CheckNormalized(iu); err != nil {
+		return err
+	}
+	nu := P(new(T))
+	*nu = *u
+	stamp := uuid.New().String()
+	nu.IdentityUser().ConcurrencyStamp = stamp
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		cur, err := s.get(tx, iu.ID)
+		if err != nil {
+			return err
+		}
+		if cur == nil || cur.IdentityUser().ConcurrencyStamp != iu.ConcurrencyStamp {
+			return aspnetusers.ErrConcurrency
+		}
+		if id := tx.Bucket(namesBucket).Get(nameKey(iu.NormalizedUserName)); id != nil && string(id) != iu.ID {
+			return aspnetusers.ErrExists
+		}
+		return s.put(tx, nu, cur)
+	})
+	if err != nil {
+		return err
+	}
+	iu.ConcurrencyStamp = stamp
+	return nil
+}
+
+// Delete removes the user with u's ID, provided its ConcurrencyStamp matches u's,
+// or returns exactly aspnetusers.ErrConcurrency.
+func (s *Store[T, P]) Delete(u P) error {
+	iu := u.IdentityUser()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		cur, err := s.get(tx, iu.ID)
+		if err != nil {
+			return err
+		}
+		if cur == nil || cur.IdentityUser().ConcurrencyStamp != iu.ConcurrencyStamp {
+			return aspnetusers.ErrConcurrency
+		}
+		if err := unindex(tx, cur.IdentityUser()); err != nil {
+			return err
+		}
+		return tx.Bucket(usersBucket).Delete([]byte(iu.ID))
+	})
+}
+
+// Each calls fn for each user in the store, in order of ID, stopping at the first error, which it returns.
+// The store must not be changed by fn, which runs within a read transaction.
+func (s *Store[T, P]) Each(fn func(u P) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(k, v []byte) error {
+			u := P(new(T))
+			if err := json.Unmarshal(v, u); err != nil {
+				return fmt.Errorf("boltstore: user %s: %v", k, err)
+			}
+			return fn(u)
+		})
+	})
+}
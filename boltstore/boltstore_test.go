@@ -0,0 +1,182 @@
+package boltstore
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/forsyth/aspnetusers"
+	"github.com/forsyth/aspnetusers/storetest"
+	_ "modernc.org/sqlite"
+)
+
+func TestStore(t *testing.T) {
+	s, err := Open[aspnetusers.User](filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	u, err := aspnetusers.NewUser(s, "Jake@example.com", "jake@example.com", "woofy")
+	if err != nil {
+		t.Fatalf("create jake: %v", err)
+	}
+	if _, err := aspnetusers.NewUser(s, "JAKE@example.com", "jake@example.com", "waffy"); err != aspnetusers.ErrExists {
+		t.Errorf("duplicate jake: want ErrExists, got %v", err)
+	}
+	if _, err := s.FindByName("nobody@example.com"); err != aspnetusers.ErrNotFound {
+		t.Errorf("FindByName of unknown name: want ErrNotFound, got %v", err)
+	}
+	fu, err := s.FindByName("jake@EXAMPLE.com")
+	if err != nil || *fu != *u {
+		t.Fatalf("FindByName: want %#v, got %#v (%v)", u, fu, err)
+	}
+
+	// optimistic concurrency
+	stale := *u
+	if err := aspnetusers.LockOut(s, u, time.Hour); err != nil {
+		t.Fatalf("lock out jake: %v", err)
+	}
+	if err := s.Update(&stale); err != aspnetusers.ErrConcurrency {
+		t.Errorf("update of stale copy: want ErrConcurrency, got %v", err)
+	}
+	fu, err = s.FindByID(u.ID)
+	if err != nil || fu.LockoutEnd == nil || !fu.LockoutEnd.Equal(*u.LockoutEnd) || fu.ConcurrencyStamp != u.ConcurrencyStamp {
+		t.Errorf("FindByID after LockOut: want %#v, got %#v (%v)", u, fu, err)
+	}
+	if _, err := aspnetusers.Authenticate(s, "jake@example.com", "woofy"); err != nil {
+		t.Errorf("Authenticate: %v", err)
+	}
+
+	// the indexes follow changes
+	v, err := aspnetusers.NewUser(s, "Jenny@example.com", "jake@example.com", "miaow")
+	if err != nil {
+		t.Fatalf("create jenny: %v", err)
+	}
+	if users, err := s.UsersByEmail("JAKE@example.com"); err != nil || len(users) != 2 {
+		t.Errorf("UsersByEmail: want 2 users, got %v (%v)", users, err)
+	}
+	v.UserName, v.NormalizedUserName = "Jake@example.com", "JAKE@EXAMPLE.COM"
+	if err := s.Update(v); err != aspnetusers.ErrExists {
+		t.Errorf("rename to existing name: want ErrExists, got %v", err)
+	}
+	v.UserName, v.NormalizedUserName = "Jen@example.com", "JEN@EXAMPLE.COM"
+	v.Email, v.NormalizedEmail = "jen@example.com", "JEN@EXAMPLE.COM"
+	if err := s.Update(v); err != nil {
+		t.Fatalf("rename jenny: %v", err)
+	}
+	if _, err := s.FindByName("Jenny@example.com"); err != aspnetusers.ErrNotFound {
+		t.Errorf("FindByName of old name: want ErrNotFound, got %v", err)
+	}
+	if fv, err := s.FindByName("jen@example.com"); err != nil || fv.ID != v.ID {
+		t.Errorf("FindByName of new name: got %v (%v)", fv, err)
+	}
+	if users, err := s.UsersByEmail("jake@example.com"); err != nil || len(users) != 1 || users[0].ID != u.ID {
+		t.Errorf("UsersByEmail after change: got %v (%v)", users, err)
+	}
+
+	// an empty name is unique, as in the SQL table, although bbolt cannot have it as a key
+	nu := &aspnetusers.User{SecurityStamp: "s", ConcurrencyStamp: "c"}
+	if err := s.Create(nu); err != nil {
+		t.Fatalf("create user without a name: %v", err)
+	}
+	if err := s.Create(&aspnetusers.User{SecurityStamp: "s", ConcurrencyStamp: "c"}); err != aspnetusers.ErrExists {
+		t.Errorf("create second user without a name: want ErrExists, got %v", err)
+	}
+	if err := s.Delete(nu); err != nil {
+		t.Errorf("delete user without a name: %v", err)
+	}
+
+	// the caller's LockoutEnd is stored in UTC, but left in its own location
+	loc := time.FixedZone("X", 3600)
+	end := time.Date(2030, 1, 2, 3, 4, 5, 0, loc)
+	lu := &aspnetusers.User{UserName: "Spot@example.com", NormalizedUserName: "SPOT@EXAMPLE.COM", LockoutEnd: &end}
+	if err := s.Create(lu); err != nil {
+		t.Fatalf("create spot: %v", err)
+	}
+	if lu.LockoutEnd != &end || end.Location() != loc {
+		t.Errorf("Create changed the caller's LockoutEnd: %v", lu.LockoutEnd)
+	}
+	if fu, err := s.FindByID(lu.ID); err != nil || fu.LockoutEnd == nil || !fu.LockoutEnd.Equal(end) || fu.LockoutEnd.Location() != time.UTC {
+		t.Errorf("FindByID of spot: want LockoutEnd %v in UTC, got %v (%v)", end, fu, err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) aspnetusers.UserStore {
+		s, err := Open[aspnetusers.User](filepath.Join(t.TempDir(), "users.db"))
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestCopy(t *testing.T) {
+	s, err := Open[aspnetusers.User](filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+	var users []*aspnetusers.User
+	for _, name := range []string{"jake@example.com", "jenny@example.com", "joseph@example.com"} {
+		u, err := aspnetusers.NewUser(s, name, name, "REdNuIlsAnyejH3")
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		users = append(users, u)
+	}
+	if err := aspnetusers.LockOut(s, users[0], time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// export to a new SQL database, as EF Core would create it
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "aspnet.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tab := aspnetusers.New(db, "AspNetUsers", aspnetusers.SQLiteDatabase)
+	if _, err := tab.Migrate(aspnetusers.LatestSchema); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	n, err := aspnetusers.Copy[*aspnetusers.User](tab, s)
+	if err != nil || n != len(users) {
+		t.Fatalf("Copy to SQL: copied %d of %d (%v)", n, len(users), err)
+	}
+	for _, u := range users {
+		su, err := tab.FindByID(u.ID)
+		if err != nil {
+			t.Fatalf("%s: FindByID: %v", u.UserName, err)
+		}
+		if su.LockoutEnd != nil && u.LockoutEnd != nil && su.LockoutEnd.Sub(*u.LockoutEnd).Abs() < time.Microsecond {
+			// SQLite keeps 100ns
+			su.LockoutEnd = u.LockoutEnd
+		}
+		if *su != *u {
+			t.Errorf("%s: want %#v, got %#v", u.UserName, u, su)
+		}
+		if err := tab.ConfirmEmail(su); err != nil {
+			t.Errorf("%s: update in SQL: %v", u.UserName, err)
+		}
+	}
+
+	// and back
+	s2, err := Open[aspnetusers.User](filepath.Join(t.TempDir(), "users2.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s2.Close()
+	n, err = aspnetusers.Copy[*aspnetusers.User](s2, tab)
+	if err != nil || n != len(users) {
+		t.Fatalf("Copy from SQL: copied %d of %d (%v)", n, len(users), err)
+	}
+	if _, err := aspnetusers.Authenticate(s2, "jenny@example.com", "REdNuIlsAnyejH3"); err != nil {
+		t.Errorf("Authenticate after import: %v", err)
+	}
+	if u, err := s2.FindByName("joseph@example.com"); err != nil || !u.EmailConfirmed {
+		t.Errorf("FindByName after import: got %v (%v)", u, err)
+	}
+}
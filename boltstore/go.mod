@@ -0,0 +1,29 @@
+module github.com/forsyth/aspnetusers/boltstore
+
+go 1.21.6
+
+require (
+	github.com/forsyth/aspnetusers v0.0.0-20261018184417-53609ef1b3b8
+	github.com/google/uuid v1.6.0
+	go.etcd.io/bbolt v1.3.10
+	modernc.org/sqlite v1.30.0
+)
+
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/forsyth/pwdatav3 v1.1.0 // indirect
+	github.com/go-sql-driver/mysql v1.8.0 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/crypto v0.29.0 // indirect
+	golang.org/x/sys v0.27.0 // indirect
+	modernc.org/gc/v3 v3.0.0-20240107210532-573471604cb6 // indirect
+	modernc.org/libc v1.50.9 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
+	modernc.org/strutil v1.2.0 // indirect
+	modernc.org/token v1.1.0 // indirect
+)
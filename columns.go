@@ -0,0 +1,436 @@
+package aspnetusers
+
+// map the columns of the users table to fields of User, following the schema actually present.
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kind is the representation of a column's value.
+type kind int
+
+const (
+	kString kind = iota // string, possibly NULL (read as "")
+	kBool               // database-specific boolean, see Database.BoolVar
+	kInt                // integer
+	kTime               // optional date and time, see Database.TimeVal
+	kScan               // sql.Scanner and driver.Valuer, converting itself
+)
+
+// identity is satisfied by values of UserType.
+type identity interface {
+	IdentityUser() *User
+}
+
+// column relates a column of the users table to a field of User,
+// or to a field of a type that embeds User.
+type column struct {
+	name  string               // name in the table
+	kind  kind                 // representation
+	field func(u identity) any // address of the corresponding field in u
+}
+
+// columnSpec describes a column of ASP.NET's users table, with the names it has had historically.
+type columnSpec struct {
+	names    []string // possible names, current name first
+	kind     kind
+	field    func(u *User) any
+	coreOnly bool // added by ASP.NET Core Identity: absent in Identity 2
+}
+
+// userColumns lists the columns in lexical order excluding Id.
+// In ASP.NET the LockoutEnd field had several different names and types historically;
+// LockoutEnd was that in use when this package was made, and Identity 2 used LockoutEndDateUtc.
+// Identity 2 also lacked the Normalized columns and ConcurrencyStamp.
+var userColumns = []columnSpec{
+	{[]string{"AccessFailedCount"}, kInt, func(u *User) any { return &u.AccessFailedCount }, false},
+	{[]string{"ConcurrencyStamp"}, kString, func(u *User) any { return &u.ConcurrencyStamp }, true},
+	{[]string{"Email"}, kString, func(u *User) any { return &u.Email }, false},
+	{[]string{"EmailConfirmed"}, kBool, func(u *User) any { return &u.EmailConfirmed }, false},
+	{[]string{"LockoutEnabled"}, kBool, func(u *User) any { return &u.LockoutEnabled }, false},
+	{[]string{"LockoutEnd", "LockoutEndDateUtc"}, kTime, func(u *User) any { return &u.LockoutEnd }, false},
+	{[]string{"NormalizedEmail"}, kString, func(u *User) any { return &u.NormalizedEmail }, true},
+	{[]string{"NormalizedUserName"}, kString, func(u *User) any { return &u.NormalizedUserName }, true},
+	{[]string{"PasswordHash"}, kString, func(u *User) any { return &u.PasswordHash }, false},
+	{[]string{"PhoneNumber"}, kString, func(u *User) any { return &u.PhoneNumber }, false},
+	{[]string{"PhoneNumberConfirmed"}, kBool, func(u *User) any { return &u.PhoneNumberConfirmed }, false},
+	{[]string{"SecurityStamp"}, kString, func(u *User) any { return &u.SecurityStamp }, false},
+	{[]string{"TwoFactorEnabled"}, kBool, func(u *User) any { return &u.TwoFactorEnabled }, false},
+	{[]string{"UserName"}, kString, func(u *User) any { return &u.UserName }, false},
+}
+
+// defaultColumns returns the mapping for the current schema, assumed by New.
+func defaultColumns() []column {
+	var cols []column
+	for _, spec := range userColumns {
+		cols = append(cols, column{spec.names[0], spec.kind, spec.userField()})
+	}
+	return cols
+}
+
+// userField returns the column's field accessor, by way of the embedded User.
+func (spec *columnSpec) userField() func(u identity) any {
+	field := spec.field
+	return func(u identity) any { return field(u.IdentityUser()) }
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// extraColumns returns the columns for fields of T tagged `aspnet:"Column"`.
+func extraColumns[T any]() ([]column, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t == reflect.TypeOf(User{}) {
+		return nil, nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("user type %v is not a struct", t)
+	}
+	var cols []column
+	for _, f := range reflect.VisibleFields(t) {
+		name, ok := f.Tag.Lookup("aspnet")
+		if !ok || name == "-" {
+			continue
+		}
+		if name == "" || strings.EqualFold(name, "Id") {
+			return nil, fmt.Errorf("user type %v: field %s: invalid column name %q", t, f.Name, name)
+		}
+		for _, spec := range userColumns {
+			for _, n := range spec.names {
+				if strings.EqualFold(name, n) {
+					return nil, fmt.Errorf("user type %v: field %s: column %s is already mapped by User", t, f.Name, name)
+				}
+			}
+		}
+		for _, c := range cols {
+			if strings.EqualFold(name, c.name) {
+				return nil, fmt.Errorf("user type %v: field %s: column %s mapped twice", t, f.Name, name)
+			}
+		}
+		var k kind
+		switch ft := f.Type; {
+		case reflect.PointerTo(ft).Implements(scannerType) && ft.Implements(valuerType):
+			k = kScan
+		case ft.Kind() == reflect.String:
+			k = kString
+		case ft.Kind() == reflect.Bool:
+			k = kBool
+		case ft.Kind() == reflect.Int || ft.Kind() == reflect.Int32 || ft.Kind() == reflect.Int64:
+			k = kInt
+		case ft == timeType || ft.Kind() == reflect.Pointer && ft.Elem() == timeType:
+			k = kTime
+		default:
+			return nil, fmt.Errorf("user type %v: field %s: unsupported type %v", t, f.Name, ft)
+		}
+		if !f.IsExported() {
+			return nil, fmt.Errorf("user type %v: field %s: not exported", t, f.Name)
+		}
+		index := f.Index
+		cols = append(cols, column{name, k, func(u identity) any {
+			return reflect.ValueOf(u).Elem().FieldByIndex(index).Addr().Interface()
+		}})
+	}
+	return cols, nil
+}
+
+// Open is like New, but inspects the table's definition in the database first,
+// to map the columns actually present (for instance, LockoutEndDateUtc instead of LockoutEnd),
+// returning an error that lists any columns that are missing or have unsuitable types.
+// The Id column's type determines the table's Key: IntKey for an integer,
+// GUIDKey for uniqueidentifier or binary, GUIDTextKey for uuid or char(36), and otherwise StringKey.
+// SQLite holds both string and Guid keys as TEXT, so there Open chooses GUIDUpperKey
+// only if the table already has a user whose ID is an upper-case Guid.
+// If the table has the ASP.NET Identity 2 (MVC 5) schema, lacking the Normalized columns
+// and ConcurrencyStamp, the Users value works in that schema's terms: see Identity2.
+// Open also determines the Identity schema version, and so the features available: see DetectSchema.
+func Open(db *sql.DB, table string, style *Database) (*Users, error) {
+	return OpenTable[User](db, table, style)
+}
+
+// OpenTable is like Open, but for a user type T that embeds User, as for NewTable.
+// The table must also have the extra columns named by T's tags.
+func OpenTable[T any, P UserType[T]](db *sql.DB, table string, style *Database) (*Table[T, P], error) {
+	if style == nil {
+		style = MySQLDatabase
+	}
+	extras, err := extraColumns[T]()
+	if err != nil {
+		return nil, err
+	}
+	types, err := tableColumns(db, table, style)
+	if err != nil {
+		return nil, err
+	}
+	cols, legacy, err := mapColumns(types, extras)
+	if err != nil {
+		return nil, fmt.Errorf("table %s: %v", table, err)
+	}
+	schema, err := detectSchema(db, table, style, types, legacy)
+	if err != nil {
+		return nil, err
+	}
+	idName, _ := findColumn(types, "Id")
+	key := keyFor(types[idName])
+	if key == StringKey && style.Dialect == "sqlite" {
+		key, err = sqliteKey(db, table, idName, style)
+		if err != nil {
+			return nil, err
+		}
+	}
+	related, err := findRelated(db, table, style)
+	if err != nil {
+		return nil, err
+	}
+	tab := &Table[T, P]{db: db, table: table, style: style, columns: cols, legacy: legacy, id: idName, key: key, schema: *schema,
+		related: related, relatedOK: true}
+	tab.prepare()
+	return tab, nil
+}
+
+// tableColumns returns the data type of each column of the table, indexed by column name.
+// A type with a maximum length includes it, as in "nvarchar(256)", or "nvarchar(max)" if unlimited.
+func tableColumns(db *sql.DB, table string, style *Database) (map[string]string, error) {
+	types, err := listColumns(db, table, style)
+	if err != nil {
+		return nil, err
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("table %s: not found", table)
+	}
+	return types, nil
+}
+
+// listColumns is like tableColumns, but returns an empty map if the table does not exist.
+func listColumns(db *sql.DB, table string, style *Database) (map[string]string, error) {
+	if style.Columns == nil {
+		return nil, fmt.Errorf("table %s: database adapter cannot list columns", table)
+	}
+	query, args := style.Columns(table)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("table %s: listing columns: %v", table, err)
+	}
+	defer rows.Close()
+	types := make(map[string]string)
+	for rows.Next() {
+		var name, dataType string
+		var size sql.NullInt64
+		if err := rows.Scan(&name, &dataType, &size); err != nil {
+			return nil, fmt.Errorf("table %s: listing columns: %v", table, err)
+		}
+		if size.Valid && !strings.Contains(dataType, "(") {
+			// larger sizes are the capacity of a text type, such as MySQL's longtext
+			switch {
+			case size.Int64 < 0:
+				dataType += "(max)" // SQL Server
+			case size.Int64 <= maxSized:
+				dataType += "(" + strconv.FormatInt(size.Int64, 10) + ")"
+			}
+		}
+		types[name] = dataType
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("table %s: listing columns: %v", table, err)
+	}
+	return types, nil
+}
+
+// maxSized is the largest length treated as a limit, rather than the capacity of a text type.
+const maxSized = 1 << 16
+
+// typeSize returns the maximum length included in a column's data type, or 0 if it has none.
+func typeSize(dataType string) int {
+	_, size, ok := strings.Cut(dataType, "(")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(size, ")"))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// mapColumns matches the columns found in the table to those known to this package,
+// and the extra ones for the user type, and reports whether the table has the Identity 2 schema.
+func mapColumns(types map[string]string, extras []column) ([]column, bool, error) {
+	var problems []string
+	if name, ok := findColumn(types, "Id"); !ok {
+		problems = append(problems, "missing column Id")
+	} else if t := types[name]; !kString.accepts(t) && !kInt.accepts(t) && !guidType(t) {
+		problems = append(problems, fmt.Sprintf("column %s has unsuitable type %s", name, t))
+	}
+	var cols []column
+	var coreMissing []string
+	ncore := 0
+	for _, spec := range userColumns {
+		name, ok := "", false
+		for _, n := range spec.names {
+			if name, ok = findColumn(types, n); ok {
+				break
+			}
+		}
+		if spec.coreOnly {
+			ncore++
+		}
+		switch {
+		case !ok && spec.coreOnly:
+			coreMissing = append(coreMissing, spec.names[0])
+		case !ok:
+			problems = append(problems, "missing column "+strings.Join(spec.names, " or "))
+		case !spec.kind.accepts(types[name]):
+			problems = append(problems, fmt.Sprintf("column %s has unsuitable type %s", name, types[name]))
+		default:
+			cols = append(cols, column{name, spec.kind, spec.userField()})
+		}
+	}
+	for _, c := range extras {
+		name, ok := findColumn(types, c.name)
+		switch {
+		case !ok:
+			problems = append(problems, "missing column "+c.name)
+		case c.kind != kScan && !c.kind.accepts(types[name]):
+			problems = append(problems, fmt.Sprintf("column %s has unsuitable type %s", name, types[name]))
+		default:
+			c.name = name
+			cols = append(cols, c)
+		}
+	}
+	// Identity 2 lacks all of them; anything in between is a mistake
+	legacy := len(coreMissing) == ncore
+	if !legacy {
+		for _, name := range coreMissing {
+			problems = append(problems, "missing column "+name)
+		}
+	}
+	if problems != nil {
+		return nil, false, fmt.Errorf("incompatible schema: %s", strings.Join(problems, "; "))
+	}
+	return cols, legacy, nil
+}
+
+// findColumn returns the table's own spelling of the named column.
+// Column names are compared without regard to case, as in MySQL and SQL Server.
+func findColumn(types map[string]string, name string) (string, bool) {
+	if _, ok := types[name]; ok {
+		return name, true
+	}
+	for n := range types {
+		if strings.EqualFold(n, name) {
+			return n, true
+		}
+	}
+	return "", false
+}
+
+// accepts reports whether a column's SQL data type can hold values of the given kind.
+// The check is loose, to accommodate the names used by each database.
+func (k kind) accepts(dataType string) bool {
+	has := func(subs ...string) bool { return containsAny(dataType, subs...) }
+	switch k {
+	case kString:
+		return has("char", "text", "clob", "uniqueidentifier", "uuid")
+	case kBool:
+		return has("bit", "bool", "int")
+	case kInt:
+		return has("int", "numeric", "decimal", "number")
+	case kTime:
+		// SQLite keeps DateTimeOffset as TEXT
+		return has("date", "time", "text", "char")
+	}
+	return false
+}
+
+// containsAny reports whether an SQL data type's name contains any of the given lower-case strings.
+func containsAny(dataType string, subs ...string) bool {
+	t := strings.ToLower(dataType)
+	for _, s := range subs {
+		if strings.Contains(t, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanVar returns a location to receive the column's value in u from Scan.
+func (c *column) scanVar(style *Database, u identity) any {
+	switch c.kind {
+	case kString:
+		return new(sql.NullString)
+	case kBool:
+		// MySQL lacks boolean type, uses numeric bit(1) or tinyint(1): must use an intermediate value
+		// arguably the driver should be brighter, given there is sql.Bool
+		v := new(any)
+		*v = style.BoolVar()
+		return v
+	case kInt:
+		return new(sql.NullInt64)
+	case kScan:
+		return c.field(u)
+	default:
+		return new(any)
+	}
+}
+
+// set assigns to u's field the value Scan left in a location returned by scanVar.
+// Fields of the string, bool and integer kinds can have named types (type Tenant string), so they are set by reflection.
+func (c *column) set(style *Database, u identity, v any) error {
+	switch c.kind {
+	case kString:
+		c.fieldValue(u).SetString(opts(v.(*sql.NullString)))
+	case kBool:
+		c.fieldValue(u).SetBool(style.BoolVal(*v.(*any)))
+	case kInt:
+		c.fieldValue(u).SetInt(v.(*sql.NullInt64).Int64)
+	case kTime:
+		t, err := style.timeVal(*v.(*any))
+		if err != nil {
+			return fmt.Errorf("%s: %v", c.name, err)
+		}
+		switch f := c.field(u).(type) {
+		case **time.Time:
+			*f = t
+		case *time.Time:
+			*f = time.Time{}
+			if t != nil {
+				*f = *t
+			}
+		}
+	}
+	return nil
+}
+
+// fieldValue returns u's field for the column, as a settable reflect.Value.
+func (c *column) fieldValue(u identity) reflect.Value {
+	return reflect.ValueOf(c.field(u)).Elem()
+}
+
+// value returns u's value for the column, in the form to be written to the database.
+func (c *column) value(style *Database, u identity) any {
+	switch c.kind {
+	case kString:
+		return c.fieldValue(u).String()
+	case kBool:
+		return c.fieldValue(u).Bool()
+	case kInt:
+		return c.fieldValue(u).Int()
+	case kTime:
+		switch f := c.field(u).(type) {
+		case **time.Time:
+			return style.timeArg(*f)
+		case *time.Time:
+			return style.timeArg(f)
+		}
+	}
+	// kScan
+	return c.fieldValue(u).Interface()
+}
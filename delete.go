@@ -0,0 +1,115 @@
+package aspnetusers
+
+// removing users, with their rows in the other Identity tables.
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// userTable is a table with rows belonging to users, and its spelling of the UserId column.
+type userTable struct {
+	name   string
+	userID string
+}
+
+// userTables lists the Identity tables whose rows belong to a user, by their UserId column.
+// EF Core's schema deletes those rows when the user is deleted (ON DELETE CASCADE).
+var userTables = []string{"AspNetUserClaims", "AspNetUserLogins", "AspNetUserRoles", "AspNetUserTokens", "AspNetUserPasskeys"}
+
+// Delete removes the user, provided its ConcurrencyStamp matches u's. Otherwise it returns exactly ErrConcurrency,
+// including when the user has already been removed, having changed nothing.
+// In the same transaction, once the stamp has been checked, it removes the user's rows from those of the tables AspNetUserClaims, AspNetUserLogins,
+// AspNetUserRoles, AspNetUserTokens and AspNetUserPasskeys that exist, as EF Core's cascading delete would,
+// whether or not the database's own foreign keys cascade.
+func (tab *Table[T, P]) Delete(u P) error {
+	iu := u.IdentityUser()
+	id, err := tab.key.Arg(iu.ID)
+	if err != nil {
+		return err
+	}
+	related, err := tab.relatedTables()
+	if err != nil {
+		return fmt.Errorf("delete user: %v", err)
+	}
+
+	tx, err := tab.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// check the stamp, holding the user's row, before touching the related rows
+	cur, err := tab.unpackUser(tx.QueryRow(tab.queryLock, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrConcurrency
+		}
+		return fmt.Errorf("delete user: %v", err)
+	}
+	if cur.IdentityUser().ConcurrencyStamp != iu.ConcurrencyStamp {
+		return ErrConcurrency
+	}
+	stamp := iu.ConcurrencyStamp
+	if tab.legacy {
+		// as in updateLegacy
+		stamp = cur.IdentityUser().SecurityStamp
+	}
+	db := tab.style
+	for _, rt := range related {
+		_, err := tx.Exec(db.cmd("DELETE FROM", ident(rt.name), "WHERE", ident(rt.userID), "=", db.Param(1)), id)
+		if err != nil {
+			return fmt.Errorf("delete user: %s: %v", rt.name, err)
+		}
+	}
+	res, err := tx.Exec(tab.remove, id, stamp)
+	if err != nil {
+		return fmt.Errorf("delete user: %v", err)
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if nr == 0 {
+		// changed or removed by another process; the rollback restores the related rows
+		return ErrConcurrency
+	}
+	return tx.Commit()
+}
+
+// relatedTables returns those of userTables that exist, which Open finds,
+// and which are otherwise found on first use, and again after Migrate.
+func (tab *Table[T, P]) relatedTables() ([]userTable, error) {
+	tab.relatedMu.Lock()
+	defer tab.relatedMu.Unlock()
+	if !tab.relatedOK {
+		related, err := findRelated(tab.db, tab.table, tab.style)
+		if err != nil {
+			return nil, err
+		}
+		tab.related, tab.relatedOK = related, true
+	}
+	return tab.related, nil
+}
+
+// forgetRelated discards the tables found by relatedTables, when they might have changed.
+func (tab *Table[T, P]) forgetRelated() {
+	tab.relatedMu.Lock()
+	tab.related, tab.relatedOK = nil, false
+	tab.relatedMu.Unlock()
+}
+
+// findRelated returns those of userTables that exist for the given users table.
+func findRelated(db *sql.DB, users string, style *Database) ([]userTable, error) {
+	var related []userTable
+	for _, name := range userTables {
+		table := relatedTable(users, name)
+		cols, err := listColumns(db, table, style)
+		if err != nil {
+			return nil, err
+		}
+		if userID, ok := findColumn(cols, "UserId"); ok {
+			related = append(related, userTable{table, userID})
+		}
+	}
+	return related, nil
+}
@@ -10,8 +10,41 @@
 // User has a primary key ID, a unique key UserName and an Email key (not necessarily unique).
 // In modern applications, the UserName will usually be an email address, but might still differ from Email.
 // Only the latter is confirmed though, so allowing them to differ might be unwise.
+//
+// Open (or New, which assumes the current schema without checking) gives access to the table.
+// Open also accepts the older ASP.NET Identity 2 (MVC 5) schema; see Users.Identity2.
+//
+// Users is the instance of the generic Table for User itself; an application whose ApplicationUser
+// adds columns can instead define a struct that embeds User, with tagged fields for those columns,
+// and use OpenTable or NewTable.
+//
 // Add new users with NewUser, find them with FindByID or FindByName (the user name) and Update
-// as required.
+// as required. Since Email need not be unique, FindByEmail returns ErrAmbiguous if several users share the address;
+// UsersByEmail lists them all. SignIn authenticates a user by either user name or email address.
+// For administration, List returns a page of users matching a Query, in order of ID or user name,
+// and Select visits every matching user without reading them all into memory.
+// Change the user name, email address or phone number with SetUserName, SetEmail and SetPhoneNumber,
+// which keep the normalised and confirmed fields consistent, as ASP.NET does;
+// Update refuses a user whose normalised fields do not match (ErrNotNormalized).
+// Package phone parses phone numbers into E.164 form for SetPhoneNumber, and reports stored numbers that do not parse.
+// Delete removes a user, with the user's roles, claims, logins, tokens and passkeys in the other Identity tables.
+// UpdateFunc applies a change to the current stored user, fetching it again and retrying if another process
+// changes it meanwhile (ErrConcurrency); ConfirmEmail, LockOut and ResetLockout do the same for a stale user.
+// Update writes every column; a Table can instead Track a user and UpdateTracked, which writes just the columns
+// changed since, optionally without checking or changing the ConcurrencyStamp, and reports conflicting columns (ConflictError).
+// Authenticate and SignIn write to the store only when AccessFailedCount changes, and not at all
+// for a Table on a read-only replica once SetTrackFailures(false) has been called.
+//
+// Table is one implementation of the Store interface, which holds just the primitive operations;
+// the functions NewUser, Authenticate, ChangePassword, ConfirmEmail, LockOut and ResetLockout
+// work over any Store, and Table's methods of the same names call them.
+// Code that needs only those can accept a UserStore, to work with other storage as well.
+// MemoryStore is another implementation, with the same behaviour, for tests that need no database,
+// and package boltstore keeps users in an embedded bbolt database. Copy moves users between stores.
+// Package mongostore keeps them in MongoDB, in the documents of the C# AspNetCore.Identity.MongoDbCore provider.
+// Package storetest checks that a Store, or a Database adapter, follows the rules the package relies on.
+// Packages boltstore, mongostore and phone are modules of their own, so that a program that does not use them
+// does not require bbolt, the MongoDB driver or libphonenumber's metadata.
 //
 // The MySQL definition of table 'aspnetusers' can act
 // as a guide to other SQL and NoSQL implementations:
@@ -38,5 +71,18 @@
 //	  UNIQUE KEY `UserNameIndex` (`NormalizedUserName`)
 //	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 //
-// Note that MySQL uses bit(1) not BOOLEAN.
+// For a new database, Migrate instead creates the users table and the other Identity tables
+// as EF Core would for the Database's dialect, for a given SchemaVersion, recording the migration
+// in __EFMigrationsHistory so that an ASP.NET Core application can later share the database.
+// DetectSchema reports the schema version and EF provider of an existing database;
+// Open does the same, and the resulting Table offers only what that version supports
+// (passkeys, for instance, need SchemaVersion3).
+//
+// Note that MySQL uses bit(1) not BOOLEAN. The Pomelo EF Core provider instead generates tinyint(1),
+// and char(36) ascii for Guid keys; MySQLDatabase accepts either form.
+//
+// A Database value adapts the package to a particular SQL dialect: MySQLDatabase (the default),
+// PostgresDatabase, SQLServerDatabase and SQLiteDatabase are provided. EF Core's Npgsql and SQL Server providers keep the C# names,
+// so on PostgreSQL the table is usually "AspNetUsers", and on SQL Server "dbo.AspNetUsers";
+// table and column names are quoted as each dialect requires.
 package aspnetusers
@@ -0,0 +1,54 @@
+// Mysqld runs an in-memory MySQL-compatible server (go-mysql-server) for the tests,
+// with empty databases aspnet0, aspnet1, ... for them to use one each.
+// It prints the server's address on the standard output, and runs until its standard input is closed,
+// as it is when the test process exits.
+//
+// It is a module of its own so that the server and its dependencies stay out of
+// the requirements of package aspnetusers.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	gms "github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/vitess/go/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	n := flag.Int("n", 32, "number of databases")
+	flag.Parse()
+	logrus.SetLevel(logrus.ErrorLevel) // it logs each failed query, including the expected duplicates
+	var dbs []gms.Database
+	for i := 0; i < *n; i++ {
+		db := memory.NewDatabase(fmt.Sprintf("aspnet%d", i))
+		db.EnablePrimaryKeyIndexes() // for foreign keys
+		dbs = append(dbs, db)
+	}
+	pro := memory.NewDBProvider(dbs...)
+	engine := sqle.NewDefault(pro)
+	sessions := func(ctx context.Context, conn *mysql.Conn, addr string) (gms.Session, error) {
+		return memory.NewSession(gms.NewBaseSessionWithClientServer(addr, gms.Client{Capabilities: conn.Capabilities}, conn.ConnectionID), pro), nil
+	}
+	srv, err := server.NewServer(server.Config{Protocol: "tcp", Address: "localhost:0"}, engine, sessions, nil)
+	if err != nil {
+		log.Fatalf("mysqld: %v", err)
+	}
+	go func() {
+		io.Copy(io.Discard, os.Stdin)
+		srv.Close()
+		os.Exit(0)
+	}()
+	fmt.Println(srv.Listener.Addr())
+	if err := srv.Start(); err != nil {
+		log.Fatalf("mysqld: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+// Package testdb provides databases for the tests of package aspnetusers and its subpackages.
+package testdb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// databases is the number of databases the server offers, and so the number of calls of MySQL in a test binary.
+const databases = 32
+
+var mysql struct {
+	sync.Mutex
+	addr  string
+	err   error
+	stdin io.WriteCloser // keeps the server's standard input open until the test process exits
+	next  int
+}
+
+// MySQL returns a DSN (with multiStatements and parseTime) for an empty database of the caller's own
+// on an in-memory MySQL-compatible server. The server, go-mysql-server, is in the separate module ./mysqld,
+// which is started with go run by the first call in the test binary, and stops when the binary exits.
+// Running it needs the go command, and the network unless its dependencies are already in the module cache;
+// if it cannot be started, MySQL skips the test.
+func MySQL(t testing.TB) string {
+	t.Helper()
+	mysql.Lock()
+	defer mysql.Unlock()
+	if mysql.addr == "" && mysql.err == nil {
+		mysql.addr, mysql.err = startMySQL()
+	}
+	if mysql.err != nil {
+		t.Skipf("MySQL test server unavailable: %v", mysql.err)
+	}
+	if mysql.next == databases {
+		t.Fatalf("MySQL test server: all %d databases in use", databases)
+	}
+	name := fmt.Sprintf("aspnet%d", mysql.next)
+	mysql.next++
+	return fmt.Sprintf("root@tcp(%s)/%s?multiStatements=true&parseTime=true", mysql.addr, name)
+}
+
+// startMySQL starts the server, and returns its address.
+func startMySQL() (string, error) {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return "", fmt.Errorf("cannot find source directory")
+	}
+	cmd := exec.Command("go", "run", ".", "-n", fmt.Sprint(databases))
+	cmd.Dir = filepath.Join(filepath.Dir(file), "mysqld")
+	cmd.Env = append(os.Environ(), "GOWORK=off") // it is not in the workspace of go.work, if any
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		cmd.Wait()
+		return "", fmt.Errorf("no address from %s: %v", cmd.Dir, err)
+	}
+	mysql.stdin = stdin
+	return strings.TrimSpace(line), nil
+}
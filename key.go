@@ -0,0 +1,191 @@
+package aspnetusers
+
+// primary keys other than strings: IdentityUser<int>, IdentityUser<Guid>.
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Key describes how a table stores its primary key Id, which User.ID always holds as a string.
+// ASP.NET's IdentityUser has a string key by default (StringKey), but IdentityUser<TKey>
+// allows others, notably int (IntKey) and Guid (GUIDKey).
+type Key struct {
+	// Generate returns the key for a new user. If it is nil, the database generates
+	// the key (for instance, with an auto-increment or identity column), and NewUser reads it back.
+	Generate func() string
+
+	// Arg converts User.ID to the value to be passed to the database.
+	Arg func(id string) (any, error)
+
+	// Val converts the value read from the Id column to the form held in User.ID.
+	Val func(a any) (string, error)
+}
+
+// StringKey is the default: a string key, such as IdentityUser's, holding a new UUID in text form.
+var StringKey = &Key{
+	Generate: newStamp,
+	Arg:      func(id string) (any, error) { return id, nil },
+	Val: func(a any) (string, error) {
+		switch a := a.(type) {
+		case string:
+			return a, nil
+		case []byte:
+			return string(a), nil
+		}
+		return "", fmt.Errorf("unexpected Id value of type %T", a)
+	},
+}
+
+// IntKey is an integer key, as for IdentityUser<int>, generated by the database.
+// User.ID holds its decimal form.
+var IntKey = &Key{
+	Arg: func(id string) (any, error) {
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer key %q", id)
+		}
+		return n, nil
+	},
+	Val: func(a any) (string, error) {
+		switch a := a.(type) {
+		case int64:
+			return strconv.FormatInt(a, 10), nil
+		case []byte:
+			return string(a), nil
+		case string:
+			return a, nil
+		}
+		return "", fmt.Errorf("unexpected Id value of type %T", a)
+	},
+}
+
+// GUIDKey is a Guid key, as for IdentityUser<Guid>, stored as 16 bytes in .NET's order
+// (that of Guid.ToByteArray, which is mixed-endian), as in SQL Server's uniqueidentifier
+// or a MySQL binary(16) column. User.ID holds the Guid's usual text form.
+var GUIDKey = &Key{
+	Generate: newStamp,
+	Arg: func(id string) (any, error) {
+		g, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Guid key %q", id)
+		}
+		return dotnetGUID(g), nil
+	},
+	Val: func(a any) (string, error) {
+		b, ok := a.([]byte)
+		if !ok || len(b) != 16 {
+			return "", fmt.Errorf("unexpected Id value %v", a)
+		}
+		return uuid.UUID(dotnetGUID(uuid.UUID(b))).String(), nil
+	},
+}
+
+// GUIDTextKey is a Guid key held as text, in the usual lower-case form, as EF Core's MySQL (Pomelo) provider
+// stores it in a char(36) column, and as PostgreSQL's uuid type returns it.
+// Unlike StringKey, it rejects IDs that are not Guids, which FindByID reports as ErrNotFound.
+var GUIDTextKey = guidTextKey(strings.ToLower)
+
+// GUIDUpperKey is a Guid key held as upper-case text, as EF Core's SQLite provider stores it.
+var GUIDUpperKey = guidTextKey(strings.ToUpper)
+
+// guidTextKey returns a Key for Guids held as text, in the case given by fold.
+func guidTextKey(fold func(string) string) *Key {
+	return &Key{
+		Generate: func() string { return fold(newStamp()) },
+		Arg: func(id string) (any, error) {
+			g, err := uuid.Parse(id)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Guid key %q", id)
+			}
+			return fold(g.String()), nil
+		},
+		Val: func(a any) (string, error) {
+			var g uuid.UUID
+			var err error
+			switch a := a.(type) {
+			case string:
+				g, err = uuid.Parse(a)
+			case []byte:
+				if len(a) == 16 {
+					// a uniqueidentifier
+					g = uuid.UUID(dotnetGUID(uuid.UUID(a)))
+				} else {
+					g, err = uuid.ParseBytes(a)
+				}
+			default:
+				err = fmt.Errorf("unexpected Id value of type %T", a)
+			}
+			if err != nil {
+				return "", err
+			}
+			return fold(g.String()), nil
+		},
+	}
+}
+
+// dotnetGUID converts between the byte order of a UUID and that of a .NET Guid,
+// which stores its first three fields little-endian. The conversion is its own inverse.
+func dotnetGUID(g uuid.UUID) []byte {
+	return []byte{
+		g[3], g[2], g[1], g[0],
+		g[5], g[4],
+		g[7], g[6],
+		g[8], g[9], g[10], g[11], g[12], g[13], g[14], g[15],
+	}
+}
+
+// SetKey sets the way the table stores its primary key, by default StringKey.
+// It must be called before the table is used.
+// Open and OpenTable choose the key from the type of the Id column.
+func (tab *Table[T, P]) SetKey(key *Key) {
+	tab.key = key
+	tab.prepare()
+}
+
+// keyFor returns the Key suited to the data type of an Id column.
+// A text column of SQLite, which might hold either, is taken to be StringKey; see sqliteKey.
+func keyFor(dataType string) *Key {
+	switch {
+	case kInt.accepts(dataType):
+		return IntKey
+	case guidType(dataType):
+		return GUIDKey
+	case textGUIDType(dataType):
+		return GUIDTextKey
+	}
+	return StringKey
+}
+
+// guidType reports whether an Id column's data type holds Guids as 16 bytes.
+func guidType(dataType string) bool {
+	return containsAny(dataType, "uniqueidentifier", "binary", "blob", "bytea")
+}
+
+// textGUIDType reports whether an Id column's data type holds Guids as text: PostgreSQL's uuid, or Pomelo's char(36).
+func textGUIDType(dataType string) bool {
+	t := strings.ToLower(dataType)
+	return t == "uuid" || strings.HasPrefix(t, "char(36)")
+}
+
+// sqliteKey returns the Key for a SQLite table whose Id column is TEXT,
+// where EF Core stores a Guid key in upper case, but a string key (by default a Guid too) in lower case.
+// It can only tell them apart from a user already present, and otherwise returns StringKey.
+func sqliteKey(db *sql.DB, table, idName string, style *Database) (*Key, error) {
+	var id string
+	err := db.QueryRow(style.cmd("SELECT", ident(idName), "FROM", ident(table), style.limit(1))).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return StringKey, nil
+		}
+		return nil, fmt.Errorf("table %s: %v", table, err)
+	}
+	if _, err := uuid.Parse(id); err == nil && id == strings.ToUpper(id) {
+		return GUIDUpperKey, nil
+	}
+	return StringKey, nil
+}
@@ -0,0 +1,118 @@
+package aspnetusers
+
+// support the ASP.NET Identity 2 (MVC 5) schema, which lacks ConcurrencyStamp.
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Identity2 reports whether the table has the older ASP.NET Identity 2 (MVC 5) schema,
+// as found by Open.
+//
+// That schema has no NormalizedUserName, NormalizedEmail or ConcurrencyStamp columns,
+// and the LockoutEnd column is LockoutEndDateUtc. FindByName looks up UserName directly,
+// relying on that column's case-insensitive collation. The Normalized fields of a User
+// are computed on reading, and ConcurrencyStamp is a digest of the row's contents as read,
+// so that Update detects a concurrent change or removal, returning ErrConcurrency, as it does for the current schema.
+// Update rereads the row in a transaction to compare the digest; that relies on the database
+// locking the row as it is read (FOR UPDATE, or SQL Server's UPDLOCK hint: see Database.LockHint).
+// A Database adapter that can do neither guards only the SecurityStamp between the read and the write.
+func (tab *Table[T, P]) Identity2() bool {
+	return tab.legacy
+}
+
+// rowStamp returns a digest of u's values for the table's columns, to act as its ConcurrencyStamp.
+func (tab *Table[T, P]) rowStamp(u P) string {
+	h := sha256.New()
+	h.Write([]byte(u.IdentityUser().ID))
+	for i := range tab.columns {
+		h.Write([]byte{0})
+		h.Write([]byte(tab.columns[i].text(u)))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// updateLegacy implements Update for the Identity 2 schema. In a transaction,
+// it rereads the row, locking it if the database allows (see Database.ForUpdate and LockHint), and compares its digest with u's ConcurrencyStamp
+// before updating it; the UPDATE also checks the SecurityStamp as read.
+// The new stamp is the digest of the row as stored, in case the database has rounded LockoutEnd.
+func (tab *Table[T, P]) updateLegacy(u P) error {
+	iu := u.IdentityUser()
+	id, err := tab.key.Arg(iu.ID)
+	if err != nil {
+		return err
+	}
+	tx, err := tab.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	cur, err := tab.unpackUser(tx.QueryRow(tab.queryLock, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrConcurrency
+		}
+		return err
+	}
+	if cur.IdentityUser().ConcurrencyStamp != iu.ConcurrencyStamp {
+		return ErrConcurrency
+	}
+	res, err := tx.Exec(tab.update, append(tab.values(u), id, cur.IdentityUser().SecurityStamp)...)
+	if err != nil {
+		if tab.style.IsDuplicate(err) {
+			return ErrExists
+		}
+		return err
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if nr == 0 {
+		return ErrConcurrency
+	}
+	nu, err := tab.unpackUser(tx.QueryRow(tab.queryLock, id))
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	iu.ConcurrencyStamp = nu.IdentityUser().ConcurrencyStamp
+	return nil
+}
+
+// text returns u's value for the column in a canonical text form.
+func (c *column) text(u identity) string {
+	switch c.kind {
+	case kString:
+		return c.fieldValue(u).String()
+	case kBool:
+		return strconv.FormatBool(c.fieldValue(u).Bool())
+	case kInt:
+		return strconv.FormatInt(c.fieldValue(u).Int(), 10)
+	}
+	switch v := c.field(u).(type) {
+	case **time.Time:
+		if *v == nil {
+			return ""
+		}
+		return (*v).UTC().Format(time.RFC3339Nano)
+	case *time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case driver.Valuer:
+		dv, err := v.Value()
+		if err != nil || dv == nil {
+			return ""
+		}
+		return fmt.Sprint(dv)
+	}
+	return ""
+}
@@ -0,0 +1,219 @@
+package aspnetusers
+
+// listing and searching users, a page at a time.
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Order is the order in which List and Select return users.
+type Order int
+
+const (
+	ByID   Order = iota // by Id, the primary key
+	ByName              // by NormalizedUserName (UserName in the Identity 2 schema)
+)
+
+// Query selects users for List and Select. Its zero value selects all users in order of ID.
+// Filters left at their zero values (nil or "") select any user; the others must all match.
+type Query struct {
+	OrderBy Order
+
+	// After, if not empty, skips users up to and including the one with this key (ID or NormalizedUserName, following OrderBy).
+	// It is set from the Next of the previous page, so that pages follow on however users are added or removed meanwhile.
+	After string
+
+	// Limit is the maximum number of users to return, or zero for no limit.
+	Limit int
+
+	EmailConfirmed   *bool
+	TwoFactorEnabled *bool
+	LockedOut        *bool  // LockoutEnabled, with a LockoutEnd still to come (see CheckLockout)
+	NamePrefix       string // start of the user name, compared in normalised form
+	EmailPrefix      string // start of the email address, compared in normalised form
+}
+
+// Page is a page of users returned by List.
+type Page[P any] struct {
+	Users []P
+
+	// Next is the Query.After value for the following page, or empty if this is the last.
+	Next string
+}
+
+// List returns a page of at most q.Limit users matching q, for an administrator's display, say.
+func (tab *Table[T, P]) List(q Query) (Page[P], error) {
+	var page Page[P]
+	limit := q.Limit
+	if limit > 0 {
+		// one more, to see whether there's another page
+		q.Limit++
+	}
+	err := tab.Select(q, func(u P) error {
+		page.Users = append(page.Users, u)
+		return nil
+	})
+	if err != nil {
+		return Page[P]{}, err
+	}
+	if limit > 0 && len(page.Users) > limit {
+		page.Users = page.Users[:limit]
+		page.Next = tab.orderKey(q.OrderBy, page.Users[limit-1])
+	}
+	return page, nil
+}
+
+// Select calls fn for each user matching q, in order, stopping at the first error, which it returns.
+// Users are read from the database as fn consumes them, not gathered in memory,
+// so Select can visit all the users of a large table; fn must not use the table meanwhile
+// if the database allows only one connection (as SQLite might).
+func (tab *Table[T, P]) Select(q Query, fn func(u P) error) error {
+	query, args, err := tab.selectQuery(q, time.Now())
+	if err != nil {
+		return err
+	}
+	rows, err := tab.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("list users: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		u, err := tab.unpackUser(rows)
+		if err != nil {
+			return fmt.Errorf("list users: %v", err)
+		}
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("list users: %v", err)
+	}
+	return nil
+}
+
+// orderKey returns u's key in the given order, for Query.After.
+func (tab *Table[T, P]) orderKey(order Order, u P) string {
+	if order == ByName {
+		if tab.legacy {
+			return u.IdentityUser().UserName
+		}
+		return u.IdentityUser().NormalizedUserName
+	}
+	return u.IdentityUser().ID
+}
+
+// selectQuery returns the SELECT statement for q, and its arguments, with now the time for LockedOut.
+func (tab *Table[T, P]) selectQuery(q Query, now time.Time) (string, []any, error) {
+	db := tab.style
+	var conds []string
+	var args []any
+	where := func(cond string, vals ...any) {
+		// each ? in cond is a parameter for the corresponding value
+		parts := strings.Split(cond, "?")
+		var sb strings.Builder
+		for i, v := range vals {
+			args = append(args, v)
+			sb.WriteString(parts[i])
+			sb.WriteString(db.Param(len(args)))
+		}
+		sb.WriteString(parts[len(vals)])
+		conds = append(conds, sb.String())
+	}
+	is := func(field func(u *User) any) string {
+		return db.Ident(tab.columnFor(field))
+	}
+
+	userName, email := "NormalizedUserName", "NormalizedEmail"
+	if tab.legacy {
+		// compared with case-insensitive collations
+		userName, email = "UserName", "Email"
+	}
+	orderBy := "Id"
+	if q.OrderBy == ByName {
+		orderBy = userName
+	}
+	if q.After != "" {
+		var after any = q.After
+		if q.OrderBy != ByName {
+			var err error
+			after, err = tab.key.Arg(q.After)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+		where(db.Ident(tab.col(orderBy))+" > ?", after)
+	}
+	if q.EmailConfirmed != nil {
+		where(is(func(u *User) any { return &u.EmailConfirmed })+" = ?", *q.EmailConfirmed)
+	}
+	if q.TwoFactorEnabled != nil {
+		where(is(func(u *User) any { return &u.TwoFactorEnabled })+" = ?", *q.TwoFactorEnabled)
+	}
+	if q.LockedOut != nil {
+		enabled, end := is(func(u *User) any { return &u.LockoutEnabled }), is(func(u *User) any { return &u.LockoutEnd })
+		if *q.LockedOut {
+			where(enabled+" = ? AND "+end+" > ?", true, db.timeArg(&now))
+		} else {
+			where("("+enabled+" = ? OR "+end+" IS NULL OR "+end+" <= ?)", false, db.timeArg(&now))
+		}
+	}
+	if q.NamePrefix != "" {
+		where(db.Ident(tab.col(userName))+" LIKE ? ESCAPE '!'", likePrefix(q.NamePrefix, tab.legacy))
+	}
+	if q.EmailPrefix != "" {
+		where(db.Ident(tab.col(email))+" LIKE ? ESCAPE '!'", likePrefix(q.EmailPrefix, tab.legacy))
+	}
+
+	query := db.cmd("SELECT", ident(tab.col("Id")), ",", tab.columnNames(), "FROM", ident(tab.table))
+	if len(conds) > 0 {
+		query = db.cmd(query, "WHERE", strings.Join(conds, " AND "))
+	}
+	query = db.cmd(query, "ORDER BY", ident(tab.col(orderBy)))
+	if q.Limit > 0 {
+		query = db.cmd(query, db.limit(q.Limit))
+	}
+	return query, args, nil
+}
+
+// likePrefix returns a LIKE pattern, with escape character !, for values starting with prefix,
+// which is normalised unless the column has a case-insensitive collation instead.
+func likePrefix(prefix string, legacy bool) string {
+	if !legacy {
+		prefix = Normalize(prefix)
+	}
+	// SQL Server also treats [ as special
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_", "[", "![").Replace(prefix) + "%"
+}
+
+// limit returns the clause that follows ORDER BY to limit the number of rows selected.
+func (db *Database) limit(n int) string {
+	if db.Dialect == "sqlserver" {
+		return fmt.Sprintf("OFFSET 0 ROWS FETCH NEXT %d ROWS ONLY", n)
+	}
+	return fmt.Sprintf("LIMIT %d", n)
+}
+
+// columnNames returns the names of the table's columns other than Id, in order.
+func (tab *Table[T, P]) columnNames() []string {
+	names := make([]string, len(tab.columns))
+	for i, c := range tab.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// columnFor returns the name of the table's column for the given field of User.
+func (tab *Table[T, P]) columnFor(field func(u *User) any) string {
+	u := P(new(T))
+	want := field(u.IdentityUser())
+	for _, c := range tab.columns {
+		if c.field(u) == want {
+			return c.name
+		}
+	}
+	// all User's fields have columns
+	panic("aspnetusers: no column for field")
+}
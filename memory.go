@@ -0,0 +1,170 @@
+package aspnetusers
+
+// users held in memory, for tests.
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryStore is a Store that holds users in memory, with the same behaviour as a Table:
+// NormalizedUserName is unique (ErrExists), Update checks the ConcurrencyStamp (ErrConcurrency),
+// and a missing user is exactly ErrNotFound. It is safe for concurrent use.
+// Values are copied in and out, so a caller's value changes the store only through Create and Update,
+// although any pointers and slices in T's own fields remain shared.
+// The zero value is an empty store.
+type MemoryStore[T any, P UserType[T]] struct {
+	mu     sync.RWMutex
+	byID   map[string]*T
+	byName map[string]*T // by NormalizedUserName
+}
+
+// MemoryUsers is a MemoryStore of plain Users.
+type MemoryUsers = MemoryStore[User, *User]
+
+var _ UserStore = (*MemoryUsers)(nil)
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore[T any, P UserType[T]]() *MemoryStore[T, P] {
+	return &MemoryStore[T, P]{}
+}
+
+// copyUser returns a copy of u, including its LockoutEnd, which is kept in UTC as a Table does.
+func copyUser[T any, P UserType[T]](u P) P {
+	nu := P(new(T))
+	*nu = *u
+	iu := nu.IdentityUser()
+	if iu.LockoutEnd != nil {
+		end := iu.LockoutEnd.UTC()
+		iu.LockoutEnd = &end
+	}
+	return nu
+}
+
+// FindByID returns a copy of the user with the given ID, or exactly ErrNotFound.
+func (s *MemoryStore[T, P]) FindByID(id string) (P, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.byID[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyUser[T, P](u), nil
+}
+
+// FindByName returns a copy of the user with the given user name, compared in normalised form, or exactly ErrNotFound.
+func (s *MemoryStore[T, P]) FindByName(name string) (P, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.byName[Normalize(name)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyUser[T, P](u), nil
+}
+
+// UsersByEmail returns copies of the users with the given email address, compared in normalised form, in order of ID.
+func (s *MemoryStore[T, P]) UsersByEmail(email string) ([]P, error) {
+	key := Normalize(email)
+	var users []P
+	s.mu.RLock()
+	for _, u := range s.byID {
+		if P(u).IdentityUser().NormalizedEmail == key {
+			users = append(users, copyUser[T, P](u))
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(users, func(i, j int) bool { return users[i].IdentityUser().ID < users[j].IdentityUser().ID })
+	return users, nil
+}
+
+// FindByEmail returns a copy of the one user with the given email address, compared in normalised form,
+// or exactly ErrNotFound or ErrAmbiguous.
+func (s *MemoryStore[T, P]) FindByEmail(email string) (P, error) {
+	return FindByEmail[P](s, email)
+}
+
+// Create adds a copy of u, returning exactly ErrExists if its NormalizedUserName or ID is already registered.
+// An empty ID is set to a new UUID, as by StringKey.
+func (s *MemoryStore[T, P]) Create(u P) error {
+	iu := u.IdentityUser()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byID == nil {
+		s.byID = make(map[string]*T)
+		s.byName = make(map[string]*T)
+	}
+	if _, ok := s.byName[iu.NormalizedUserName]; ok {
+		return ErrExists
+	}
+	id := iu.ID
+	if id == "" {
+		id = newStamp()
+	}
+	if _, ok := s.byID[id]; ok {
+		return ErrExists
+	}
+	iu.ID = id
+	nu := copyUser[T, P](u)
+	s.byID[id] = nu
+	s.byName[iu.NormalizedUserName] = nu
+	return nil
+}
+
+// Update replaces the user with u's ID, provided the ConcurrencyStamps match, and gives u a new ConcurrencyStamp.
+// Otherwise it returns exactly ErrConcurrency, or ErrExists if u's NormalizedUserName belongs to another user.
+// It returns ErrNotNormalized as a Table does.
+func (s *MemoryStore[T, P]) Update(u P) error {
+	iu := u.IdentityUser()
+	if err := CheckNormalized(iu); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.byID[iu.ID]
+	if !ok || P(cur).IdentityUser().ConcurrencyStamp != iu.ConcurrencyStamp {
+		return ErrConcurrency
+	}
+	if other, ok := s.byName[iu.NormalizedUserName]; ok && other != cur {
+		return ErrExists
+	}
+	nu := copyUser[T, P](u)
+	nu.IdentityUser().ConcurrencyStamp = newStamp()
+	delete(s.byName, P(cur).IdentityUser().NormalizedUserName)
+	s.byID[iu.ID] = nu
+	s.byName[iu.NormalizedUserName] = nu
+	iu.ConcurrencyStamp = nu.IdentityUser().ConcurrencyStamp
+	return nil
+}
+
+// Delete removes the user with u's ID, provided the ConcurrencyStamps match, or returns exactly ErrConcurrency.
+func (s *MemoryStore[T, P]) Delete(u P) error {
+	iu := u.IdentityUser()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.byID[iu.ID]
+	if !ok || P(cur).IdentityUser().ConcurrencyStamp != iu.ConcurrencyStamp {
+		return ErrConcurrency
+	}
+	delete(s.byID, iu.ID)
+	delete(s.byName, P(cur).IdentityUser().NormalizedUserName)
+	return nil
+}
+
+// Each calls fn for a copy of each user in the store, in order of ID, stopping at the first error,
+// which it returns. The store can be changed meanwhile.
+func (s *MemoryStore[T, P]) Each(fn func(u P) error) error {
+	s.mu.RLock()
+	users := make([]P, 0, len(s.byID))
+	for _, u := range s.byID {
+		users = append(users, copyUser[T, P](u))
+	}
+	s.mu.RUnlock()
+	sort.Slice(users, func(i, j int) bool { return users[i].IdentityUser().ID < users[j].IdentityUser().ID })
+	for _, u := range users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+module github.com/forsyth/aspnetusers/mongostore
+
+go 1.21.6
+
+require (
+	github.com/forsyth/aspnetusers v0.0.0-20261018184417-53609ef1b3b8
+	github.com/google/uuid v1.6.0
+	go.mongodb.org/mongo-driver/v2 v2.0.0
+)
+
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/forsyth/pwdatav3 v1.1.0 // indirect
+	github.com/go-sql-driver/mysql v1.8.0 // indirect
+	github.com/golang/snappy v0.0.4 // indirect
+	github.com/klauspost/compress v1.16.7 // indirect
+	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
+	github.com/xdg-go/scram v1.1.2 // indirect
+	github.com/xdg-go/stringprep v1.0.4 // indirect
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78 // indirect
+	golang.org/x/crypto v0.29.0 // indirect
+	golang.org/x/sync v0.9.0 // indirect
+	golang.org/x/text v0.20.0 // indirect
+)
@@ -0,0 +1,421 @@
+// Package mongostore keeps ASP.NET Identity users in MongoDB, in the document shape of
+// the AspNetCore.Identity.MongoDbCore provider (MongoIdentityUser), so that a Go program and
+// a C# service using that provider can share the users collection.
+//
+// A user document holds the IdentityUser properties under their C# names, with LockoutEnd
+// as a BSON date, together with the provider's own fields: Version, CreatedOn, and the
+// embedded Roles, Claims, Logins and Tokens arrays. The Store reads and writes only
+// the IdentityUser properties of existing documents, leaving the rest as the C# service left them;
+// Roles and Claims can be read with the methods of those names.
+package mongostore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/forsyth/aspnetusers"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// IDFormat is the BSON representation of the document's _id, the user's ID.
+type IDFormat int
+
+const (
+	// GuidLegacy is a Guid as BSON binary subtype 3, in .NET's byte order,
+	// the default of version 2 of the C# driver (GuidRepresentation.CSharpLegacy).
+	GuidLegacy IDFormat = iota
+
+	// GuidStandard is a Guid as BSON binary subtype 4 (GuidRepresentation.Standard),
+	// the default of version 3 of the C# driver.
+	GuidStandard
+
+	// StringID is a string, as for MongoIdentityUser<string>.
+	StringID
+)
+
+// Store keeps plain aspnetusers.Users in a MongoDB collection.
+// It is safe for concurrent use.
+type Store struct {
+	coll *mongo.Collection
+	ids  IDFormat
+}
+
+var _ aspnetusers.UserStore = (*Store)(nil)
+
+// Claim is a claim embedded in a user document.
+type Claim struct {
+	Type   string `bson:"Type"`
+	Value  string `bson:"Value"`
+	Issuer string `bson:"Issuer"`
+}
+
+// document is the part of a user document that holds IdentityUser's properties.
+type document struct {
+	ID                   any        `bson:"_id"`
+	UserName             *string    `bson:"UserName"`
+	NormalizedUserName   *string    `bson:"NormalizedUserName"`
+	Email                *string    `bson:"Email"`
+	NormalizedEmail      *string    `bson:"NormalizedEmail"`
+	EmailConfirmed       bool       `bson:"EmailConfirmed"`
+	PasswordHash         *string    `bson:"PasswordHash"`
+	SecurityStamp        *string    `bson:"SecurityStamp"`
+	ConcurrencyStamp     *string    `bson:"ConcurrencyStamp"`
+	PhoneNumber          *string    `bson:"PhoneNumber"`
+	PhoneNumberConfirmed bool       `bson:"PhoneNumberConfirmed"`
+	TwoFactorEnabled     bool       `bson:"TwoFactorEnabled"`
+	LockoutEnd           *time.Time `bson:"LockoutEnd"`
+	LockoutEnabled       bool       `bson:"LockoutEnabled"`
+	AccessFailedCount    int        `bson:"AccessFailedCount"`
+}
+
+// New returns a Store for the users in the given collection, whose documents have IDs in the given format.
+// Unless the C# service has already done so, call EnsureIndexes once as well: without the unique index
+// on NormalizedUserName, Create and Update cannot return ErrExists, and duplicate names are stored.
+func New(coll *mongo.Collection, ids IDFormat) *Store {
+	return &Store{coll: coll, ids: ids}
+}
+
+// EnsureIndexes creates the indexes the Store relies on, if they do not exist:
+// a unique index on NormalizedUserName, which makes duplicate names fail with ErrExists,
+// and an index on NormalizedEmail.
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "NormalizedUserName", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "NormalizedEmail", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("mongostore: creating indexes: %v", err)
+	}
+	return nil
+}
+
+// idValue converts a user's ID to the value of _id.
+func (s *Store) idValue(id string) (any, error) {
+	switch s.ids {
+	case GuidLegacy:
+		b, err := aspnetusers.GUIDKey.Arg(id)
+		if err != nil {
+			return nil, err
+		}
+		return bson.Binary{Subtype: bson.TypeBinaryUUIDOld, Data: b.([]byte)}, nil
+	case GuidStandard:
+		g, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Guid key %q", id)
+		}
+		return bson.Binary{Subtype: bson.TypeBinaryUUID, Data: g[:]}, nil
+	}
+	return id, nil
+}
+
+// idString converts a value of _id to a user's ID.
+func idString(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bson.Binary:
+		switch v.Subtype {
+		case bson.TypeBinaryUUIDOld:
+			return aspnetusers.GUIDKey.Val(v.Data)
+		case bson.TypeBinaryUUID:
+			g, err := uuid.FromBytes(v.Data)
+			if err != nil {
+				return "", err
+			}
+			return g.String(), nil
+		}
+	}
+	return "", fmt.Errorf("unexpected _id %v", v)
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// user returns the User held in a document.
+func (d *document) user() (*aspnetusers.User, error) {
+	id, err := idString(d.ID)
+	if err != nil {
+		return nil, err
+	}
+	u := &aspnetusers.User{
+		ID:                   id,
+		UserName:             str(d.UserName),
+		NormalizedUserName:   str(d.NormalizedUserName),
+		Email:                str(d.Email),
+		NormalizedEmail:      str(d.NormalizedEmail),
+		EmailConfirmed:       d.EmailConfirmed,
+		PasswordHash:         str(d.PasswordHash),
+		SecurityStamp:        str(d.SecurityStamp),
+		ConcurrencyStamp:     str(d.ConcurrencyStamp),
+		PhoneNumber:          str(d.PhoneNumber),
+		PhoneNumberConfirmed: d.PhoneNumberConfirmed,
+		TwoFactorEnabled:     d.TwoFactorEnabled,
+		LockoutEnabled:       d.LockoutEnabled,
+		AccessFailedCount:    d.AccessFailedCount,
+	}
+	if d.LockoutEnd != nil {
+		end := d.LockoutEnd.UTC()
+		u.LockoutEnd = &end
+	}
+	return u, nil
+}
+
+// fields returns the IdentityUser properties of u, in C#'s order, as stored in its document.
+func fields(u *aspnetusers.User) bson.D {
+	var end any // null
+	if u.LockoutEnd != nil {
+		end = bson.NewDateTimeFromTime(*u.LockoutEnd)
+	}
+	return bson.D{
+		{Key: "UserName", Value: u.UserName},
+		{Key: "NormalizedUserName", Value: u.NormalizedUserName},
+		{Key: "Email", Value: u.Email},
+		{Key: "NormalizedEmail", Value: u.NormalizedEmail},
+		{Key: "EmailConfirmed", Value: u.EmailConfirmed},
+		{Key: "PasswordHash", Value: u.PasswordHash},
+		{Key: "SecurityStamp", Value: u.SecurityStamp},
+		{Key: "ConcurrencyStamp", Value: u.ConcurrencyStamp},
+		{Key: "PhoneNumber", Value: u.PhoneNumber},
+		{Key: "PhoneNumberConfirmed", Value: u.PhoneNumberConfirmed},
+		{Key: "TwoFactorEnabled", Value: u.TwoFactorEnabled},
+		{Key: "LockoutEnd", Value: end},
+		{Key: "LockoutEnabled", Value: u.LockoutEnabled},
+		{Key: "AccessFailedCount", Value: int32(u.AccessFailedCount)},
+	}
+}
+
+// newDocument returns the whole document for a new user, as MongoDbCore creates it.
+func (s *Store) newDocument(id any, u *aspnetusers.User, created time.Time) bson.D {
+	doc := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "Version", Value: int32(1)},
+		{Key: "CreatedOn", Value: bson.NewDateTimeFromTime(created)},
+		{Key: "Claims", Value: bson.A{}},
+		{Key: "Roles", Value: bson.A{}},
+		{Key: "Logins", Value: bson.A{}},
+		{Key: "Tokens", Value: bson.A{}},
+	}
+	return append(doc, fields(u)...)
+}
+
+// match returns a filter for the document with the given _id and ConcurrencyStamp.
+// An empty stamp matches a null or missing one too, as the user's ConcurrencyStamp is then read as empty.
+func match(id any, stamp string) bson.D {
+	var v any = stamp
+	if stamp == "" {
+		v = bson.D{{Key: "$in", Value: bson.A{nil, ""}}}
+	}
+	return bson.D{{Key: "_id", Value: id}, {Key: "ConcurrencyStamp", Value: v}}
+}
+
+// findOne returns the user matching the filter, or exactly ErrNotFound.
+func (s *Store) findOne(filter bson.D) (*aspnetusers.User, error) {
+	var d document
+	err := s.coll.FindOne(context.Background(), filter).Decode(&d)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, aspnetusers.ErrNotFound
+		}
+		return nil, fmt.Errorf("mongostore: find user: %v", err)
+	}
+	return d.user()
+}
+
+// FindByID returns the user with the given ID, or exactly aspnetusers.ErrNotFound.
+func (s *Store) FindByID(id string) (*aspnetusers.User, error) {
+	v, err := s.idValue(id)
+	if err != nil {
+		// no user can have it
+		return nil, aspnetusers.ErrNotFound
+	}
+	return s.findOne(bson.D{{Key: "_id", Value: v}})
+}
+
+// FindByName returns the user with the given user name, compared in normalised form,
+// or exactly aspnetusers.ErrNotFound.
+func (s *Store) FindByName(name string) (*aspnetusers.User, error) {
+	return s.findOne(bson.D{{Key: "NormalizedUserName", Value: aspnetusers.Normalize(name)}})
+}
+
+// UsersByEmail returns the users with the given email address, compared in normalised form, in order of _id.
+// Unlike user names, email addresses need not be unique.
+func (s *Store) UsersByEmail(email string) ([]*aspnetusers.User, error) {
+	var users []*aspnetusers.User
+	err := s.find(bson.D{{Key: "NormalizedEmail", Value: aspnetusers.Normalize(email)}}, func(u *aspnetusers.User) error {
+		users = append(users, u)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// FindByEmail returns the one user with the given email address, compared in normalised form,
+// or exactly aspnetusers.ErrNotFound or aspnetusers.ErrAmbiguous.
+func (s *Store) FindByEmail(email string) (*aspnetusers.User, error) {
+	return aspnetusers.FindByEmail[*aspnetusers.User](s, email)
+}
+
+// Create adds a document for a new user, returning exactly aspnetusers.ErrExists if its
+// NormalizedUserName (given the unique index made by EnsureIndexes) or ID is already registered.
+// An empty ID is set to a new Guid.
+func (s *Store) Create(u *aspnetusers.User) error {
+	id := u.ID
+	if id == "" {
+		id = uuid.New().String()
+	}
+	v, err := s.idValue(id)
+	if err != nil {
+		return err
+	}
+	_, err = s.coll.InsertOne(context.Background(), s.newDocument(v, u, time.Now()))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return aspnetusers.ErrExists
+		}
+		return fmt.Errorf("mongostore: adding new user: %v", err)
+	}
+	u.ID = id
+	return nil
+}
+
+// Update sets the IdentityUser properties of the user's document, provided its ConcurrencyStamp
+// matches u's, and gives u a new ConcurrencyStamp. Otherwise it returns exactly aspnetusers.ErrConcurrency,
+// or aspnetusers.ErrExists if u's NormalizedUserName belongs to another user,
+// or aspnetusers.ErrNotNormalized if aspnetusers.CheckNormalized fails.
+// Other fields of the document are unchanged.
+func (s *Store) Update(u *aspnetusers.User) error {
+	if err := aspnetusers.CheckNormalized(u); err != nil {
+		return err
+	}
+	v, err := s.idValue(u.ID)
+	if err != nil {
+		return err
+	}
+	nu := *u
+	nu.ConcurrencyStamp = uuid.New().String()
+	res, err := s.coll.UpdateOne(context.Background(),
+		match(v, u.ConcurrencyStamp),
+		bson.D{{Key: "$set", Value: fields(&nu)}})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return aspnetusers.ErrExists
+		}
+		return fmt.Errorf("mongostore: update user: %v", err)
+	}
+	if res.MatchedCount == 0 {
+		// lost race: was updated (hence new concurrency stamp) or deleted by another process
+		return aspnetusers.ErrConcurrency
+	}
+	u.ConcurrencyStamp = nu.ConcurrencyStamp
+	return nil
+}
+
+// Delete removes the user's document, with its embedded roles, claims, logins and tokens,
+// provided its ConcurrencyStamp matches u's, or returns exactly aspnetusers.ErrConcurrency.
+func (s *Store) Delete(u *aspnetusers.User) error {
+	v, err := s.idValue(u.ID)
+	if err != nil {
+		return aspnetusers.ErrConcurrency
+	}
+	res, err := s.coll.DeleteOne(context.Background(), match(v, u.ConcurrencyStamp))
+	if err != nil {
+		return fmt.Errorf("mongostore: delete user: %v", err)
+	}
+	if res.DeletedCount == 0 {
+		return aspnetusers.ErrConcurrency
+	}
+	return nil
+}
+
+// Each calls fn for each user in the collection, in order of _id, stopping at the first error, which it returns.
+func (s *Store) Each(fn func(u *aspnetusers.User) error) error {
+	return s.find(bson.D{}, fn)
+}
+
+// find calls fn for each user matching the filter, in order of _id, stopping at the first error, which it returns.
+func (s *Store) find(filter bson.D, fn func(u *aspnetusers.User) error) error {
+	ctx := context.Background()
+	cur, err := s.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("mongostore: find users: %v", err)
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var d document
+		if err := cur.Decode(&d); err != nil {
+			return fmt.Errorf("mongostore: find users: %v", err)
+		}
+		u, err := d.user()
+		if err != nil {
+			return fmt.Errorf("mongostore: find users: %v", err)
+		}
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("mongostore: find users: %v", err)
+	}
+	return nil
+}
+
+// embedded returns the named embedded array of the user's document.
+func (s *Store) embedded(u *aspnetusers.User, name string) (bson.RawValue, error) {
+	v, err := s.idValue(u.ID)
+	if err != nil {
+		return bson.RawValue{}, aspnetusers.ErrNotFound
+	}
+	raw, err := s.coll.FindOne(context.Background(), bson.D{{Key: "_id", Value: v}},
+		options.FindOne().SetProjection(bson.D{{Key: name, Value: 1}})).Raw()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return bson.RawValue{}, aspnetusers.ErrNotFound
+		}
+		return bson.RawValue{}, fmt.Errorf("mongostore: %s: %v", name, err)
+	}
+	return raw.Lookup(name), nil
+}
+
+// Claims returns the claims embedded in the user's document.
+func (s *Store) Claims(u *aspnetusers.User) ([]Claim, error) {
+	rv, err := s.embedded(u, "Claims")
+	if err != nil || rv.Type != bson.TypeArray {
+		return nil, err
+	}
+	var claims []Claim
+	if err := rv.Unmarshal(&claims); err != nil {
+		return nil, fmt.Errorf("mongostore: Claims: %v", err)
+	}
+	return claims, nil
+}
+
+// Roles returns the IDs of the roles listed in the user's document.
+func (s *Store) Roles(u *aspnetusers.User) ([]string, error) {
+	rv, err := s.embedded(u, "Roles")
+	if err != nil || rv.Type != bson.TypeArray {
+		return nil, err
+	}
+	var ids []any
+	if err := rv.Unmarshal(&ids); err != nil {
+		return nil, fmt.Errorf("mongostore: Roles: %v", err)
+	}
+	roles := make([]string, len(ids))
+	for i, v := range ids {
+		roles[i], err = idString(v)
+		if err != nil {
+			return nil, fmt.Errorf("mongostore: Roles: %v", err)
+		}
+	}
+	return roles, nil
+}
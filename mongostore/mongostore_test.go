@@ -0,0 +1,245 @@
+package mongostore
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/forsyth/aspnetusers"
+	"github.com/forsyth/aspnetusers/storetest"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// TestDocument checks the encoding of a user document against that written by MongoDbCore.
+func TestDocument(t *testing.T) {
+	const id = "6f9619ff-8b86-d011-b42d-00c04fc964ff"
+	end := time.Date(2024, 3, 1, 12, 30, 0, 0, time.FixedZone("CET", 3600))
+	u := &aspnetusers.User{
+		ID:                 id,
+		UserName:           "Jake@example.com",
+		NormalizedUserName: "JAKE@EXAMPLE.COM",
+		ConcurrencyStamp:   "stamp",
+		LockoutEnd:         &end,
+		LockoutEnabled:     true,
+		AccessFailedCount:  2,
+	}
+	for _, tc := range []struct {
+		ids     IDFormat
+		subtype byte
+		data    []byte
+	}{
+		{GuidLegacy, bson.TypeBinaryUUIDOld, []byte{0xff, 0x19, 0x96, 0x6f, 0x86, 0x8b, 0x11, 0xd0, 0xb4, 0x2d, 0x00, 0xc0, 0x4f, 0xc9, 0x64, 0xff}},
+		{GuidStandard, bson.TypeBinaryUUID, []byte{0x6f, 0x96, 0x19, 0xff, 0x8b, 0x86, 0xd0, 0x11, 0xb4, 0x2d, 0x00, 0xc0, 0x4f, 0xc9, 0x64, 0xff}},
+		{StringID, 0, nil},
+	} {
+		s := New(nil, tc.ids)
+		v, err := s.idValue(id)
+		if err != nil {
+			t.Fatalf("%d: idValue: %v", tc.ids, err)
+		}
+		raw, err := bson.Marshal(s.newDocument(v, u, time.Now()))
+		if err != nil {
+			t.Fatalf("%d: Marshal: %v", tc.ids, err)
+		}
+		doc := bson.Raw(raw)
+		rid := doc.Lookup("_id")
+		if tc.ids == StringID {
+			if sv, ok := rid.StringValueOK(); !ok || sv != id {
+				t.Errorf("%d: _id: want string %q, got %v", tc.ids, id, rid)
+			}
+		} else if st, data, ok := rid.BinaryOK(); !ok || st != tc.subtype || string(data) != string(tc.data) {
+			t.Errorf("%d: _id: want subtype %d % x, got %v", tc.ids, tc.subtype, tc.data, rid)
+		}
+		if rv := doc.Lookup("LockoutEnd"); rv.Type != bson.TypeDateTime {
+			t.Errorf("%d: LockoutEnd: want a date, got %v", tc.ids, rv.Type)
+		}
+		if rv := doc.Lookup("Roles"); rv.Type != bson.TypeArray {
+			t.Errorf("%d: Roles: want an array, got %v", tc.ids, rv.Type)
+		}
+
+		var d document
+		if err := bson.Unmarshal(raw, &d); err != nil {
+			t.Fatalf("%d: Unmarshal: %v", tc.ids, err)
+		}
+		du, err := d.user()
+		if err != nil {
+			t.Fatalf("%d: decode: %v", tc.ids, err)
+		}
+		if du.LockoutEnd == nil || !du.LockoutEnd.Equal(end) || du.LockoutEnd.Location() != time.UTC {
+			t.Errorf("%d: LockoutEnd: want %v in UTC, got %v", tc.ids, end, du.LockoutEnd)
+		}
+		du.LockoutEnd = u.LockoutEnd
+		if *du != *u {
+			t.Errorf("%d: want %#v, got %#v", tc.ids, u, du)
+		}
+	}
+
+	// null values, as C# writes them
+	raw, err := bson.Marshal(bson.D{{Key: "_id", Value: id}, {Key: "Email", Value: nil}, {Key: "LockoutEnd", Value: nil}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d document
+	if err := bson.Unmarshal(raw, &d); err != nil {
+		t.Fatalf("Unmarshal with nulls: %v", err)
+	}
+	if du, err := d.user(); err != nil || du.Email != "" || du.LockoutEnd != nil {
+		t.Errorf("nulls: got %#v (%v)", du, err)
+	}
+}
+
+// TestMatch checks that an empty ConcurrencyStamp matches a document whose stamp is null or missing,
+// as one written by another program might be.
+func TestMatch(t *testing.T) {
+	raw, err := bson.Marshal(match("id", "stamp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sv, ok := bson.Raw(raw).Lookup("ConcurrencyStamp").StringValueOK(); !ok || sv != "stamp" {
+		t.Errorf("stamp: want \"stamp\", got %v", bson.Raw(raw))
+	}
+	raw, err = bson.Marshal(match("id", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, ok := bson.Raw(raw).Lookup("ConcurrencyStamp", "$in").ArrayOK()
+	if !ok {
+		t.Fatalf("empty stamp: want $in, got %v", bson.Raw(raw))
+	}
+	vals, err := in.Values()
+	if err != nil || len(vals) != 2 || vals[0].Type != bson.TypeNull || vals[1].StringValue() != "" {
+		t.Errorf("empty stamp: want $in [null, \"\"], got %v (%v)", in, err)
+	}
+}
+
+// collection returns an empty scratch collection on the MongoDB server given by $USERS_MONGO_URI,
+// with the Store's indexes, skipping the test if that is not set.
+func collection(t *testing.T) *mongo.Collection {
+	uri := os.Getenv("USERS_MONGO_URI")
+	if uri == "" {
+		t.Skip("USERS_MONGO_URI not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect(ctx) })
+	coll := client.Database("aspnetusers_test").Collection("Users")
+	if err := coll.Drop(ctx); err != nil {
+		t.Fatalf("Drop: %v", err)
+	}
+	t.Cleanup(func() { coll.Drop(ctx) })
+	if err := New(coll, GuidLegacy).EnsureIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return coll
+}
+
+func TestConformance(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		ids  IDFormat
+	}{
+		{"GuidLegacy", GuidLegacy},
+		{"GuidStandard", GuidStandard},
+		{"StringID", StringID},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			storetest.Run(t, func(t *testing.T) aspnetusers.UserStore {
+				return New(collection(t), tt.ids)
+			})
+		})
+	}
+}
+
+// TestStore checks what the conformance tests cannot: the fields of the document
+// that the Store does not own.
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	coll := collection(t)
+	s := New(coll, GuidLegacy)
+
+	u, err := aspnetusers.NewUser(s, "Jake@example.com", "jake@example.com", "woofy")
+	if err != nil {
+		t.Fatalf("create jake: %v", err)
+	}
+	if _, err := aspnetusers.NewUser(s, "JAKE@example.com", "jake@example.com", "waffy"); err != aspnetusers.ErrExists {
+		t.Errorf("duplicate jake: want ErrExists, got %v", err)
+	}
+	if _, err := s.FindByName("nobody@example.com"); err != aspnetusers.ErrNotFound {
+		t.Errorf("FindByName of unknown name: want ErrNotFound, got %v", err)
+	}
+	if _, err := s.FindByID("not a guid"); err != aspnetusers.ErrNotFound {
+		t.Errorf("FindByID of invalid ID: want ErrNotFound, got %v", err)
+	}
+
+	// roles and claims written by the C# service survive an update
+	v, _ := s.idValue(u.ID)
+	_, err = coll.UpdateOne(ctx, bson.D{{Key: "_id", Value: v}}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "Roles", Value: bson.A{bson.Binary{Subtype: bson.TypeBinaryUUIDOld, Data: make([]byte, 16)}}},
+		{Key: "Claims", Value: bson.A{bson.D{{Key: "Type", Value: "role"}, {Key: "Value", Value: "admin"}, {Key: "Issuer", Value: "LOCAL"}}}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := *u
+	if err := aspnetusers.LockOut(s, u, time.Hour); err != nil {
+		t.Fatalf("lock out jake: %v", err)
+	}
+	if err := s.Update(&stale); err != aspnetusers.ErrConcurrency {
+		t.Errorf("update of stale copy: want ErrConcurrency, got %v", err)
+	}
+	fu, err := s.FindByID(u.ID)
+	if err != nil || fu.LockoutEnd == nil || fu.LockoutEnd.Sub(*u.LockoutEnd).Abs() >= time.Millisecond || fu.ConcurrencyStamp != u.ConcurrencyStamp {
+		t.Errorf("FindByID after LockOut: want %#v, got %#v (%v)", u, fu, err)
+	}
+	if roles, err := s.Roles(u); err != nil || len(roles) != 1 || roles[0] != "00000000-0000-0000-0000-000000000000" {
+		t.Errorf("Roles: got %v (%v)", roles, err)
+	}
+	if claims, err := s.Claims(u); err != nil || len(claims) != 1 || claims[0] != (Claim{"role", "admin", "LOCAL"}) {
+		t.Errorf("Claims: got %v (%v)", claims, err)
+	}
+	if _, err := aspnetusers.Authenticate(s, "jake@example.com", "woofy"); err != nil {
+		t.Errorf("Authenticate: %v", err)
+	}
+
+	w, err := aspnetusers.NewUser(s, "Jenny@example.com", "jenny@example.com", "miaow")
+	if err != nil {
+		t.Fatalf("create jenny: %v", err)
+	}
+	w.UserName, w.NormalizedUserName = "Jake@example.com", "JAKE@EXAMPLE.COM"
+	if err := s.Update(w); err != aspnetusers.ErrExists {
+		t.Errorf("rename to existing name: want ErrExists, got %v", err)
+	}
+	n := 0
+	if err := s.Each(func(*aspnetusers.User) error { n++; return nil }); err != nil || n != 2 {
+		t.Errorf("Each: want 2 users, got %d (%v)", n, err)
+	}
+
+	// a document without a ConcurrencyStamp, or with a null one, can be updated and deleted
+	for _, stamp := range []bson.E{{Key: "$unset", Value: bson.D{{Key: "ConcurrencyStamp", Value: ""}}}, {Key: "$set", Value: bson.D{{Key: "ConcurrencyStamp", Value: nil}}}} {
+		v, _ := s.idValue(w.ID)
+		if _, err := coll.UpdateOne(ctx, bson.D{{Key: "_id", Value: v}}, bson.D{stamp}); err != nil {
+			t.Fatal(err)
+		}
+		nu, err := s.FindByID(w.ID)
+		if err != nil || nu.ConcurrencyStamp != "" {
+			t.Fatalf("%s ConcurrencyStamp: FindByID: got %v (%v)", stamp.Key, nu, err)
+		}
+		nu.EmailConfirmed = true
+		if err := s.Update(nu); err != nil || nu.ConcurrencyStamp == "" {
+			t.Errorf("%s ConcurrencyStamp: Update: got stamp %q (%v)", stamp.Key, nu.ConcurrencyStamp, err)
+		}
+	}
+	v, _ = s.idValue(w.ID)
+	if _, err := coll.UpdateOne(ctx, bson.D{{Key: "_id", Value: v}}, bson.D{{Key: "$unset", Value: bson.D{{Key: "ConcurrencyStamp", Value: ""}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(&aspnetusers.User{ID: w.ID}); err != nil {
+		t.Errorf("Delete without a ConcurrencyStamp: %v", err)
+	}
+}
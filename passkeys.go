@@ -0,0 +1,102 @@
+package aspnetusers
+
+// passkeys, kept in AspNetUserPasskeys from Identity schema version 3.
+
+import (
+	"fmt"
+)
+
+// Passkey is a WebAuthn credential registered for a user, as ASP.NET Core Identity stores it.
+type Passkey struct {
+	CredentialID []byte // the credential's ID, its key
+	Data         string // JSON form of ASP.NET's UserPasskeyInfo (public key, sign count, and so on), kept as-is
+}
+
+// passkeyTable returns the name of the passkeys table, or ErrUnsupported if the schema lacks it.
+func (tab *Table[T, P]) passkeyTable() (string, error) {
+	if tab.schema.Version < SchemaVersion3 {
+		return "", ErrUnsupported
+	}
+	return tab.tableName("AspNetUserPasskeys"), nil
+}
+
+// Passkeys returns the passkeys registered for the user.
+// It returns ErrUnsupported if the table's schema precedes SchemaVersion3.
+func (tab *Table[T, P]) Passkeys(u P) ([]Passkey, error) {
+	table, err := tab.passkeyTable()
+	if err != nil {
+		return nil, err
+	}
+	id, err := tab.key.Arg(u.IdentityUser().ID)
+	if err != nil {
+		return nil, err
+	}
+	db := tab.style
+	rows, err := tab.db.Query(db.cmd("SELECT", ident("CredentialId"), ",", ident("Data"), "FROM", ident(table), "WHERE", ident("UserId"), "=", db.Param(1)), id)
+	if err != nil {
+		return nil, fmt.Errorf("passkeys: %v", err)
+	}
+	defer rows.Close()
+	var keys []Passkey
+	for rows.Next() {
+		var pk Passkey
+		if err := rows.Scan(&pk.CredentialID, &pk.Data); err != nil {
+			return nil, fmt.Errorf("passkeys: %v", err)
+		}
+		keys = append(keys, pk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("passkeys: %v", err)
+	}
+	return keys, nil
+}
+
+// AddPasskey registers a passkey for the user, returning ErrExists if its credential ID is already registered.
+// It returns ErrUnsupported if the table's schema precedes SchemaVersion3.
+func (tab *Table[T, P]) AddPasskey(u P, pk Passkey) error {
+	table, err := tab.passkeyTable()
+	if err != nil {
+		return err
+	}
+	id, err := tab.key.Arg(u.IdentityUser().ID)
+	if err != nil {
+		return err
+	}
+	db := tab.style
+	_, err = tab.db.Exec(db.cmd("INSERT INTO", ident(table), "(", []string{"CredentialId", "UserId", "Data"}, ") VALUES (", db.params(3), ")"),
+		pk.CredentialID, id, pk.Data)
+	if err != nil {
+		if db.IsDuplicate(err) {
+			return ErrExists
+		}
+		return fmt.Errorf("adding passkey: %v", err)
+	}
+	return nil
+}
+
+// RemovePasskey removes the user's passkey with the given credential ID, returning ErrNotFound if there is none.
+// It returns ErrUnsupported if the table's schema precedes SchemaVersion3.
+func (tab *Table[T, P]) RemovePasskey(u P, credentialID []byte) error {
+	table, err := tab.passkeyTable()
+	if err != nil {
+		return err
+	}
+	id, err := tab.key.Arg(u.IdentityUser().ID)
+	if err != nil {
+		return err
+	}
+	db := tab.style
+	res, err := tab.db.Exec(db.cmd("DELETE FROM", ident(table), "WHERE", ident("CredentialId"), "=", db.Param(1), "AND", ident("UserId"), "=", db.Param(2)),
+		credentialID, id)
+	if err != nil {
+		return fmt.Errorf("removing passkey: %v", err)
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if nr == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+module github.com/forsyth/aspnetusers/phone
+
+go 1.21.6
+
+require (
+	github.com/forsyth/aspnetusers v0.0.0-20261018184417-53609ef1b3b8
+	github.com/nyaruka/phonenumbers v1.5.0
+)
+
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/forsyth/pwdatav3 v1.1.0 // indirect
+	github.com/go-sql-driver/mysql v1.8.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	golang.org/x/crypto v0.29.0 // indirect
+	golang.org/x/exp v0.0.0-20240525044651-4c93da0ed11d // indirect
+	golang.org/x/text v0.20.0 // indirect
+	google.golang.org/protobuf v1.34.1 // indirect
+)
@@ -0,0 +1,137 @@
+// Package phone parses the free-form phone numbers that users type on the ASP.NET side
+// into E.164 form (+14155550123), which SMS providers expect, using the country metadata
+// of Google's libphonenumber, compiled into the program so that no lookup service is needed.
+//
+// ASP.NET stores PhoneNumber as the user typed it, and the C# application might display
+// or compare that text, so nothing here changes a stored number unless asked:
+// SetPhoneNumber stores the E.164 form of a number the user is entering now,
+// Check reports the stored numbers that do not parse, and only Normalize rewrites existing ones.
+package phone
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/forsyth/aspnetusers"
+	"github.com/nyaruka/phonenumbers"
+)
+
+// ErrInvalid is returned for a number that parses but is not a valid number in its region
+// (it has the wrong length, say, or an unallocated prefix).
+// Numbers that cannot be parsed at all yield the errors of package phonenumbers, such as
+// phonenumbers.ErrNotANumber, or phonenumbers.ErrInvalidCountryCode for a national number
+// with no default region.
+var ErrInvalid = errors.New("invalid phone number")
+
+// Parse returns number in E.164 form. A number without an international prefix
+// (+ or the region's own, such as 00) is taken to be in region, an ISO 3166 two-letter code
+// such as "GB", which may be empty if all numbers are expected to be international.
+func Parse(number, region string) (string, error) {
+	pn, err := phonenumbers.Parse(number, strings.ToUpper(region))
+	if err != nil {
+		return "", err
+	}
+	if !phonenumbers.IsValidNumber(pn) {
+		return "", ErrInvalid
+	}
+	return phonenumbers.Format(pn, phonenumbers.E164), nil
+}
+
+// SetPhoneNumber parses number as Parse does, and changes the user's phone number to its E.164 form,
+// as aspnetusers.SetPhoneNumber does. An empty number removes the user's phone number.
+// Both u and the store are left unchanged on failure.
+func SetPhoneNumber[T any, P aspnetusers.UserType[T]](s aspnetusers.Store[P], u P, number, region string) error {
+	if strings.TrimSpace(number) == "" {
+		return aspnetusers.SetPhoneNumber(s, u, "")
+	}
+	e164, err := Parse(number, region)
+	if err != nil {
+		return err
+	}
+	return aspnetusers.SetPhoneNumber(s, u, e164)
+}
+
+// Problem describes a user whose stored phone number could not be parsed (by Check),
+// or could not be rewritten (by Normalize).
+type Problem struct {
+	ID          string
+	UserName    string
+	PhoneNumber string // as stored
+	Err         error
+}
+
+// Check returns the users with a phone number that Parse rejects, in the order that l.Each visits them.
+// Users without a phone number are not problems. It changes nothing.
+func Check[T any, P aspnetusers.UserType[T]](l aspnetusers.Lister[P], region string) ([]Problem, error) {
+	var problems []Problem
+	err := l.Each(func(u P) error {
+		iu := u.IdentityUser()
+		if iu.PhoneNumber == "" {
+			return nil
+		}
+		if _, err := Parse(iu.PhoneNumber, region); err != nil {
+			problems = append(problems, problem(iu, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return problems, nil
+}
+
+// Normalize rewrites each stored phone number that parses but is not already in E.164 form,
+// and returns the number of users changed, and the problems found, as for Check.
+// A user changed meanwhile by another process is left alone, and reported as a Problem with aspnetusers.ErrConcurrency.
+// Since the number itself is the same, PhoneNumberConfirmed and the SecurityStamp are kept
+// (unlike SetPhoneNumber), so users are neither asked to confirm again nor signed out.
+// The C# application will see the new form, which matters if it compares numbers as text.
+func Normalize[T any, P aspnetusers.UserType[T]](s interface {
+	aspnetusers.Store[P]
+	aspnetusers.Lister[P]
+}, region string) (int, []Problem, error) {
+	var problems []Problem
+	var change []P
+	var was []string // their stored numbers
+	err := s.Each(func(u P) error {
+		iu := u.IdentityUser()
+		if iu.PhoneNumber == "" {
+			return nil
+		}
+		e164, err := Parse(iu.PhoneNumber, region)
+		if err != nil {
+			problems = append(problems, problem(iu, err))
+			return nil
+		}
+		if e164 != iu.PhoneNumber {
+			// updated once Each is done, since a store might allow only one connection
+			nu := P(new(T))
+			*nu = *u
+			nu.IdentityUser().PhoneNumber = e164
+			change = append(change, nu)
+			was = append(was, iu.PhoneNumber)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	n := 0
+	for i, u := range change {
+		switch err := s.Update(u); err {
+		case nil:
+			n++
+		case aspnetusers.ErrConcurrency:
+			p := problem(u.IdentityUser(), err)
+			p.PhoneNumber = was[i]
+			problems = append(problems, p)
+		default:
+			return n, problems, err
+		}
+	}
+	return n, problems, nil
+}
+
+func problem(u *aspnetusers.User, err error) Problem {
+	return Problem{ID: u.ID, UserName: u.UserName, PhoneNumber: u.PhoneNumber, Err: err}
+}
@@ -0,0 +1,90 @@
+package phone
+
+import (
+	"testing"
+
+	"github.com/forsyth/aspnetusers"
+	"github.com/nyaruka/phonenumbers"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		number, region string
+		want           string
+		err            error
+	}{
+		{"+1 (415) 555-2671", "", "+14155552671", nil},
+		{"415.555.2671", "US", "+14155552671", nil},
+		{"020 7946 0958", "gb", "+442079460958", nil},
+		{"0044 20 7946 0958", "GB", "+442079460958", nil},
+		{"+44 (0)20 7946 0958", "US", "+442079460958", nil},
+		{"07911 123456", "GB", "+447911123456", nil},
+		{"07911 123456", "", "", phonenumbers.ErrInvalidCountryCode},
+		{"call me", "GB", "", phonenumbers.ErrNotANumber},
+		{"+44 20 7946", "", "", ErrInvalid},
+		{"555-0000", "US", "", ErrInvalid},
+	} {
+		got, err := Parse(tc.number, tc.region)
+		if got != tc.want || err != tc.err {
+			t.Errorf("Parse(%q, %q): want %q (%v), got %q (%v)", tc.number, tc.region, tc.want, tc.err, got, err)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := aspnetusers.NewMemoryStore[aspnetusers.User]()
+	newUser := func(name, phone string, confirmed bool) *aspnetusers.User {
+		u, err := aspnetusers.NewUser(s, name, name, "woofy")
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		// as the C# application might have stored it
+		u.PhoneNumber, u.PhoneNumberConfirmed = phone, confirmed
+		if err := s.Update(u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	jake := newUser("jake@example.com", "020 7946 0958", true)
+	jenny := newUser("jenny@example.com", "not known", false)
+	newUser("jim@example.com", "", false)
+	newUser("jill@example.com", "+447911123456", true)
+
+	problems, err := Check(s, "GB")
+	if err != nil || len(problems) != 1 || problems[0].ID != jenny.ID || problems[0].PhoneNumber != "not known" || problems[0].Err != phonenumbers.ErrNotANumber {
+		t.Errorf("Check: want jenny's number, got %+v (%v)", problems, err)
+	}
+	if fu, _ := s.FindByID(jake.ID); fu.PhoneNumber != "020 7946 0958" {
+		t.Errorf("Check changed jake's number to %q", fu.PhoneNumber)
+	}
+
+	u := *jenny
+	if err := SetPhoneNumber(s, &u, "12", "GB"); err == nil {
+		t.Errorf("SetPhoneNumber of invalid number: want error")
+	}
+	if u != *jenny {
+		t.Errorf("SetPhoneNumber changed the user on failure")
+	}
+	if err := SetPhoneNumber(s, &u, "(0)7911 123789", "GB"); err != nil {
+		t.Fatalf("SetPhoneNumber: %v", err)
+	}
+	if fu, _ := s.FindByID(jenny.ID); fu.PhoneNumber != "+447911123789" || fu.PhoneNumberConfirmed || fu.SecurityStamp == jenny.SecurityStamp {
+		t.Errorf("SetPhoneNumber: got %#v", fu)
+	}
+	if err := SetPhoneNumber(s, &u, " ", "GB"); err != nil || u.PhoneNumber != "" {
+		t.Errorf("SetPhoneNumber to empty: got %q (%v)", u.PhoneNumber, err)
+	}
+
+	// Normalize rewrites only jake's number, keeping its confirmation
+	n, problems, err := Normalize[aspnetusers.User](s, "GB")
+	if err != nil || n != 1 || len(problems) != 0 {
+		t.Fatalf("Normalize: want 1 user changed, got %d, %+v (%v)", n, problems, err)
+	}
+	fu, _ := s.FindByID(jake.ID)
+	if fu.PhoneNumber != "+442079460958" || !fu.PhoneNumberConfirmed || fu.SecurityStamp != jake.SecurityStamp {
+		t.Errorf("Normalize: got %#v", fu)
+	}
+	if n, _, err := Normalize[aspnetusers.User](s, "GB"); err != nil || n != 0 {
+		t.Errorf("second Normalize: want no change, got %d (%v)", n, err)
+	}
+}
@@ -0,0 +1,641 @@
+package aspnetusers
+
+// create the ASP.NET Core Identity tables, and migrate them between schema versions, as EF Core would.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SchemaVersion identifies a version of the ASP.NET Core Identity schema,
+// as chosen in C# by IdentityOptions.Stores.SchemaVersion (IdentitySchemaVersions).
+type SchemaVersion int
+
+const (
+	SchemaIdentity2 SchemaVersion = 0 // ASP.NET Identity 2 (MVC 5), which predates EF Core: see Identity2
+	SchemaVersion1  SchemaVersion = 1 // the original ASP.NET Core schema
+	SchemaVersion2  SchemaVersion = 2 // .NET 8: PhoneNumber is limited to 256 characters
+	SchemaVersion3  SchemaVersion = 3 // .NET 10: adds AspNetUserPasskeys
+
+	LatestSchema = SchemaVersion3
+)
+
+// Migration IDs recorded in __EFMigrationsHistory. The first is that of the migration
+// in the ASP.NET project templates, so that a C# application built from one sees its
+// own initial migration as applied. The others record upgrades made by Migrate.
+const (
+	createMigration = "00000000000000_CreateIdentitySchema"
+	historyTable    = "__EFMigrationsHistory"
+	ef6HistoryTable = "__MigrationHistory" // Entity Framework 6, for Identity 2
+)
+
+var upgradeMigrations = map[SchemaVersion]string{
+	SchemaVersion2: "00000000000001_IdentitySchemaVersion2",
+	SchemaVersion3: "00000000000002_IdentitySchemaVersion3",
+}
+
+// productVersions gives the EF Core version recorded with a migration to each schema version.
+var productVersions = map[SchemaVersion]string{
+	SchemaVersion1: "6.0.0",
+	SchemaVersion2: "8.0.0",
+	SchemaVersion3: "10.0.0",
+}
+
+// ddlType is an abstract column type, rendered for each dialect by Database.typeName.
+type ddlType int
+
+const (
+	tKey    ddlType = iota // string key
+	tString                // string of limited length
+	tText                  // string of unlimited length
+	tBool
+	tInt
+	tSerial   // integer key generated by the database
+	tTime     // DateTimeOffset
+	tBytes    // binary of limited length
+	tGUID     // Guid key as bytes, see GUIDKey
+	tGUIDText // Guid key as the provider stores it by default, see GUIDTextKey
+)
+
+type ddlColumn struct {
+	name string
+	typ  ddlType
+	size int // for tString, tBytes and key columns that are shorter than usual
+	null bool
+}
+
+type ddlIndex struct {
+	name    string
+	columns []string
+	unique  bool
+}
+
+// ddlTable describes one of the Identity tables as EF Core creates it.
+// Each foreign key refers to the Id of another Identity table, with cascading delete.
+type ddlTable struct {
+	name    string            // ASP.NET's name for the table
+	since   SchemaVersion     // first version that has it
+	columns []ddlColumn       // in EF Core's order
+	key     []string          // primary key
+	refs    map[string]string // foreign key column to ASP.NET name of table
+	indexes []ddlIndex
+}
+
+// identityTables returns the Identity tables as EF Core creates them at the given version,
+// for a users table with the given key and extra columns.
+// The users table is first, and each table follows those it refers to.
+func identityTables(version SchemaVersion, key *Key, extras []column) []ddlTable {
+	idType, refType := tKey, tKey
+	switch key {
+	case IntKey:
+		idType, refType = tSerial, tInt
+	case GUIDKey:
+		idType, refType = tGUID, tGUID
+	case GUIDTextKey, GUIDUpperKey:
+		idType, refType = tGUIDText, tGUIDText
+	}
+	phone := ddlColumn{"PhoneNumber", tText, 0, true}
+	if version >= SchemaVersion2 {
+		phone = ddlColumn{"PhoneNumber", tString, 256, true}
+	}
+	users := ddlTable{
+		name: "AspNetUsers",
+		columns: []ddlColumn{
+			{"Id", idType, 0, false},
+			{"UserName", tString, 256, true},
+			{"NormalizedUserName", tString, 256, true},
+			{"Email", tString, 256, true},
+			{"NormalizedEmail", tString, 256, true},
+			{"EmailConfirmed", tBool, 0, false},
+			{"PasswordHash", tText, 0, true},
+			{"SecurityStamp", tText, 0, true},
+			{"ConcurrencyStamp", tText, 0, true},
+			phone,
+			{"PhoneNumberConfirmed", tBool, 0, false},
+			{"TwoFactorEnabled", tBool, 0, false},
+			{"LockoutEnd", tTime, 0, true},
+			{"LockoutEnabled", tBool, 0, false},
+			{"AccessFailedCount", tInt, 0, false},
+		},
+		key: []string{"Id"},
+		indexes: []ddlIndex{
+			{"EmailIndex", []string{"NormalizedEmail"}, false},
+			{"UserNameIndex", []string{"NormalizedUserName"}, true},
+		},
+	}
+	for _, c := range extras {
+		// as EF Core maps the corresponding C# types
+		switch c.kind {
+		case kBool:
+			users.columns = append(users.columns, ddlColumn{c.name, tBool, 0, false})
+		case kInt:
+			users.columns = append(users.columns, ddlColumn{c.name, tInt, 0, false})
+		case kTime:
+			users.columns = append(users.columns, ddlColumn{c.name, tTime, 0, true})
+		default:
+			users.columns = append(users.columns, ddlColumn{c.name, tText, 0, true})
+		}
+	}
+	tables := []ddlTable{
+		users,
+		{
+			name: "AspNetRoles",
+			columns: []ddlColumn{
+				{"Id", tKey, 0, false},
+				{"Name", tString, 256, true},
+				{"NormalizedName", tString, 256, true},
+				{"ConcurrencyStamp", tText, 0, true},
+			},
+			key:     []string{"Id"},
+			indexes: []ddlIndex{{"RoleNameIndex", []string{"NormalizedName"}, true}},
+		},
+		{
+			name: "AspNetRoleClaims",
+			columns: []ddlColumn{
+				{"Id", tSerial, 0, false},
+				{"RoleId", tKey, 0, false},
+				{"ClaimType", tText, 0, true},
+				{"ClaimValue", tText, 0, true},
+			},
+			key:     []string{"Id"},
+			refs:    map[string]string{"RoleId": "AspNetRoles"},
+			indexes: []ddlIndex{{"IX_AspNetRoleClaims_RoleId", []string{"RoleId"}, false}},
+		},
+		{
+			name: "AspNetUserClaims",
+			columns: []ddlColumn{
+				{"Id", tSerial, 0, false},
+				{"UserId", refType, 0, false},
+				{"ClaimType", tText, 0, true},
+				{"ClaimValue", tText, 0, true},
+			},
+			key:     []string{"Id"},
+			refs:    map[string]string{"UserId": "AspNetUsers"},
+			indexes: []ddlIndex{{"IX_AspNetUserClaims_UserId", []string{"UserId"}, false}},
+		},
+		{
+			name: "AspNetUserLogins",
+			columns: []ddlColumn{
+				{"LoginProvider", tKey, 128, false},
+				{"ProviderKey", tKey, 128, false},
+				{"ProviderDisplayName", tText, 0, true},
+				{"UserId", refType, 0, false},
+			},
+			key:     []string{"LoginProvider", "ProviderKey"},
+			refs:    map[string]string{"UserId": "AspNetUsers"},
+			indexes: []ddlIndex{{"IX_AspNetUserLogins_UserId", []string{"UserId"}, false}},
+		},
+		{
+			name: "AspNetUserRoles",
+			columns: []ddlColumn{
+				{"UserId", refType, 0, false},
+				{"RoleId", tKey, 0, false},
+			},
+			key:     []string{"UserId", "RoleId"},
+			refs:    map[string]string{"RoleId": "AspNetRoles", "UserId": "AspNetUsers"},
+			indexes: []ddlIndex{{"IX_AspNetUserRoles_RoleId", []string{"RoleId"}, false}},
+		},
+		{
+			name: "AspNetUserTokens",
+			columns: []ddlColumn{
+				{"UserId", refType, 0, false},
+				{"LoginProvider", tKey, 128, false},
+				{"Name", tKey, 128, false},
+				{"Value", tText, 0, true},
+			},
+			key:  []string{"UserId", "LoginProvider", "Name"},
+			refs: map[string]string{"UserId": "AspNetUsers"},
+		},
+		{
+			name:  "AspNetUserPasskeys",
+			since: SchemaVersion3,
+			columns: []ddlColumn{
+				{"CredentialId", tBytes, 1024, false},
+				{"UserId", refType, 0, false},
+				{"Data", tText, 0, false}, // JSON
+			},
+			key:     []string{"CredentialId"},
+			refs:    map[string]string{"UserId": "AspNetUsers"},
+			indexes: []ddlIndex{{"IX_AspNetUserPasskeys_UserId", []string{"UserId"}, false}},
+		},
+	}
+	var result []ddlTable
+	for _, t := range tables {
+		if t.since <= version {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// typeName returns the dialect's name for a column type, as generated by its EF Core provider
+// (Pomelo for MySQL, Npgsql for PostgreSQL).
+func (db *Database) typeName(c ddlColumn) string {
+	size := func(def int) string {
+		if c.size != 0 {
+			def = c.size
+		}
+		return fmt.Sprintf("(%d)", def)
+	}
+	switch db.Dialect {
+	case "mysql":
+		return map[ddlType]string{
+			tKey: "varchar" + size(255), tString: "varchar" + size(0), tText: "longtext",
+			tBool: "tinyint(1)", tInt: "int", tSerial: "int", tTime: "datetime(6)",
+			tBytes: "varbinary" + size(0), tGUID: "binary(16)", tGUIDText: "char(36) CHARACTER SET ascii COLLATE ascii_general_ci",
+		}[c.typ]
+	case "postgres":
+		key := "text"
+		if c.size != 0 {
+			key = "character varying" + size(0)
+		}
+		return map[ddlType]string{
+			tKey: key, tString: "character varying" + size(0), tText: "text",
+			tBool: "boolean", tInt: "integer", tSerial: "integer", tTime: "timestamp with time zone",
+			tBytes: "bytea", tGUID: "bytea", tGUIDText: "uuid",
+		}[c.typ]
+	case "sqlserver":
+		return map[ddlType]string{
+			tKey: "nvarchar" + size(450), tString: "nvarchar" + size(0), tText: "nvarchar(max)",
+			tBool: "bit", tInt: "int", tSerial: "int", tTime: "datetimeoffset",
+			tBytes: "varbinary" + size(0), tGUID: "uniqueidentifier", tGUIDText: "uniqueidentifier",
+		}[c.typ]
+	case "sqlite":
+		return map[ddlType]string{
+			tKey: "TEXT", tString: "TEXT", tText: "TEXT",
+			tBool: "INTEGER", tInt: "INTEGER", tSerial: "INTEGER", tTime: "TEXT",
+			tBytes: "BLOB", tGUID: "BLOB", tGUIDText: "TEXT",
+		}[c.typ]
+	}
+	return ""
+}
+
+// tableName returns the name of the Identity table with ASP.NET's name aspName; see relatedTable.
+func (tab *Table[T, P]) tableName(aspName string) string {
+	return relatedTable(tab.table, aspName)
+}
+
+// relatedTable returns the name of the Identity table with ASP.NET's name aspName,
+// following the name of the users table: in the same schema, and in lower case if it is.
+// The migration history tables keep their names.
+func relatedTable(users string, aspName string) string {
+	schema, name, ok := strings.Cut(users, ".")
+	if !ok {
+		schema, name = "", users
+	}
+	if aspName == "AspNetUsers" {
+		return users
+	}
+	if name == strings.ToLower(name) && aspName != historyTable && aspName != ef6HistoryTable {
+		aspName = strings.ToLower(aspName)
+	}
+	if schema != "" {
+		return schema + "." + aspName
+	}
+	return aspName
+}
+
+// createTable returns the statements that create a table and its indexes.
+func (tab *Table[T, P]) createTable(t *ddlTable) []string {
+	db := tab.style
+	name := tab.tableName(t.name)
+	var defs []string
+	// EF Core's Sqlite provider declares a single-column key with the column,
+	// as it must for AUTOINCREMENT
+	inlineKey := db.Dialect == "sqlite" && len(t.key) == 1
+	for _, c := range t.columns {
+		def := db.Ident(c.name) + " " + db.typeName(c)
+		switch {
+		case !c.null:
+			def += " NOT NULL"
+		case db.Dialect != "postgres":
+			def += " NULL"
+		}
+		if inlineKey && c.name == t.key[0] {
+			def += " CONSTRAINT " + db.Ident("PK_"+t.name) + " PRIMARY KEY"
+		}
+		if c.typ == tSerial {
+			switch db.Dialect {
+			case "mysql":
+				def += " AUTO_INCREMENT"
+			case "postgres":
+				def += " GENERATED BY DEFAULT AS IDENTITY"
+			case "sqlserver":
+				def += " IDENTITY"
+			case "sqlite":
+				def += " AUTOINCREMENT"
+			}
+		}
+		defs = append(defs, def)
+	}
+	if !inlineKey {
+		defs = append(defs, "CONSTRAINT "+db.Ident("PK_"+t.name)+" PRIMARY KEY ("+db.quoteAll(t.key)+")")
+	}
+	for _, c := range t.columns {
+		if ref, ok := t.refs[c.name]; ok {
+			defs = append(defs, "CONSTRAINT "+db.Ident("FK_"+t.name+"_"+ref+"_"+c.name)+
+				" FOREIGN KEY ("+db.Ident(c.name)+") REFERENCES "+db.Ident(tab.tableName(ref))+" ("+db.Ident("Id")+") ON DELETE CASCADE")
+		}
+	}
+	create := "CREATE TABLE " + db.Ident(name) + " (\n\t" + strings.Join(defs, ",\n\t") + "\n)"
+	if db.Dialect == "mysql" {
+		create += " CHARACTER SET=utf8mb4"
+	}
+	stmts := []string{create}
+	for _, ix := range t.indexes {
+		s := "CREATE INDEX "
+		if ix.unique {
+			s = "CREATE UNIQUE INDEX "
+		}
+		s += db.Ident(ix.name) + " ON " + db.Ident(name) + " (" + db.quoteAll(ix.columns) + ")"
+		if ix.unique && db.Dialect == "sqlserver" {
+			// SQL Server allows only one NULL in a unique index unless it is filtered
+			s += " WHERE " + db.Ident(ix.columns[0]) + " IS NOT NULL"
+		}
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
+
+// alterColumn returns the statement that changes the type of an existing column,
+// or "" if the dialect's types do not distinguish the change.
+func (tab *Table[T, P]) alterColumn(table string, c ddlColumn) string {
+	db := tab.style
+	name := db.Ident(table)
+	col := db.Ident(c.name)
+	null := " NOT NULL"
+	if c.null {
+		null = " NULL"
+	}
+	switch db.Dialect {
+	case "mysql":
+		return "ALTER TABLE " + name + " MODIFY " + col + " " + db.typeName(c) + null
+	case "postgres":
+		return "ALTER TABLE " + name + " ALTER COLUMN " + col + " TYPE " + db.typeName(c)
+	case "sqlserver":
+		return "ALTER TABLE " + name + " ALTER COLUMN " + col + " " + db.typeName(c) + null
+	}
+	return ""
+}
+
+func (db *Database) quoteAll(names []string) string {
+	q := make([]string, len(names))
+	for i, n := range names {
+		q[i] = db.Ident(n)
+	}
+	return strings.Join(q, ", ")
+}
+
+// Migrate brings the ASP.NET Core Identity schema in the table's database up to the given version,
+// creating the users table (with any extra columns of T) and the other Identity tables
+// (AspNetRoles, AspNetUserClaims and so on) that do not yet exist, with the types, lengths,
+// keys and indexes that the dialect's EF Core provider would generate,
+// and upgrading existing tables from earlier versions.
+// The other tables' names follow the users table's: in the same schema, and in lower case if it is.
+//
+// Migrate records what it has done in EF Core's __EFMigrationsHistory table,
+// under the migration ID of the ASP.NET project templates' initial migration
+// (00000000000000_CreateIdentitySchema), and one further ID for each upgrade;
+// a C# application can then add its own migrations without recreating the Identity tables.
+// It also returns the statements it executed.
+// A new users table for a Guid key has the type that the EF Core provider gives a Guid:
+// uniqueidentifier on SQL Server, with GUIDKey, and otherwise text (char(36) for MySQL, uuid for PostgreSQL,
+// TEXT for SQLite), so if the Table has GUIDKey, Migrate changes it to GUIDTextKey, or GUIDUpperKey for SQLite.
+// The binary forms remain available by setting GUIDKey on a table created otherwise.
+// Migrate is idempotent: if the schema is already up to date, it does nothing, returning no statements.
+// It must not be used for an Identity 2 table.
+func (tab *Table[T, P]) Migrate(version SchemaVersion) ([]string, error) {
+	if version < SchemaVersion1 || version > LatestSchema {
+		return nil, fmt.Errorf("migrate: unknown schema version %d", version)
+	}
+	if tab.legacy {
+		return nil, errors.New("migrate: table has the Identity 2 schema")
+	}
+	defer tab.forgetRelated() // it might create them
+	db := tab.style
+	if db.typeName(ddlColumn{typ: tText}) == "" {
+		return nil, fmt.Errorf("migrate: unknown SQL dialect %q", db.Dialect)
+	}
+	var done []string
+	exec := func(stmt string, args ...any) error {
+		if _, err := tab.db.Exec(stmt, args...); err != nil {
+			return fmt.Errorf("migrate: %v", err)
+		}
+		done = append(done, stmt)
+		return nil
+	}
+	history := tab.tableName(historyTable)
+	cols, err := listColumns(tab.db, history, db)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %v", err)
+	}
+	if len(cols) == 0 {
+		err = exec(db.cmd("CREATE TABLE", ident(history), "(",
+			db.Ident("MigrationId"), db.typeName(ddlColumn{typ: tString, size: 150}), "NOT NULL,",
+			db.Ident("ProductVersion"), db.typeName(ddlColumn{typ: tString, size: 32}), "NOT NULL,",
+			"CONSTRAINT", db.Ident("PK_"+historyTable), "PRIMARY KEY (", db.Ident("MigrationId"), "))"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	ids, _, err := readHistory(tab.db, history, db)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %v", err)
+	}
+	applied := map[string]bool{}
+	for _, id := range ids {
+		applied[id] = true
+	}
+	record := func(id string, v SchemaVersion) error {
+		if applied[id] {
+			return nil
+		}
+		applied[id] = true
+		return exec(db.cmd("INSERT INTO", ident(history), "(", []string{"MigrationId", "ProductVersion"}, ") VALUES (", db.params(2), ")"),
+			id, productVersions[v])
+	}
+
+	// the version of the existing schema, if any
+	users, err := listColumns(tab.db, tab.table, db)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %v", err)
+	}
+	base := version
+	if len(users) != 0 {
+		s, err := detectSchema(tab.db, tab.table, db, users, false)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %v", err)
+		}
+		base = min(s.Version, version)
+	}
+
+	if len(users) == 0 && tab.key == GUIDKey {
+		switch db.Dialect {
+		case "sqlite":
+			tab.SetKey(GUIDUpperKey)
+		case "mysql", "postgres":
+			tab.SetKey(GUIDTextKey)
+		}
+	}
+	for _, t := range identityTables(version, tab.key, tab.columns[len(userColumns):]) {
+		cols, err := listColumns(tab.db, tab.tableName(t.name), db)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %v", err)
+		}
+		if len(cols) != 0 {
+			continue
+		}
+		for _, stmt := range tab.createTable(&t) {
+			if err := exec(stmt); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// version 2 limits PhoneNumber, which an existing version 1 table does not
+	if version >= SchemaVersion2 && len(users) != 0 {
+		if name, ok := findColumn(users, "PhoneNumber"); ok && typeSize(users[name]) == 0 {
+			if stmt := tab.alterColumn(tab.table, ddlColumn{name, tString, 256, true}); stmt != "" {
+				if err := exec(stmt); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// an existing schema without history is recorded as created at the version it had
+	if err := record(createMigration, base); err != nil {
+		return nil, err
+	}
+	for v := base + 1; v <= version; v++ {
+		if err := record(upgradeMigrations[v], v); err != nil {
+			return nil, err
+		}
+	}
+	if version > tab.schema.Version {
+		tab.schema.Version = version
+	}
+	return done, nil
+}
+
+// readHistory returns the IDs of the migrations recorded in an EF history table, in order,
+// and the ProductVersion recorded by the last; it returns nothing if the table does not exist.
+func readHistory(db *sql.DB, history string, style *Database) ([]string, string, error) {
+	cols, err := listColumns(db, history, style)
+	if err != nil || len(cols) == 0 {
+		return nil, "", err
+	}
+	rows, err := db.Query(style.cmd("SELECT", ident("MigrationId"), ",", ident("ProductVersion"), "FROM", ident(history), "ORDER BY", ident("MigrationId")))
+	if err != nil {
+		return nil, "", fmt.Errorf("reading %s: %v", history, err)
+	}
+	defer rows.Close()
+	var ids []string
+	var product string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id, &product); err != nil {
+			return nil, "", fmt.Errorf("reading %s: %v", history, err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("reading %s: %v", history, err)
+	}
+	return ids, product, nil
+}
+
+// Schema describes the Identity schema of a users table and its database.
+type Schema struct {
+	Version        SchemaVersion // Identity schema version
+	Provider       string        // NuGet package of the EF provider that the schema's types suggest
+	ProductVersion string        // EF version recorded by the last migration applied, if any
+	Migrations     []string      // IDs of the migrations applied, in order, if recorded
+}
+
+// DetectSchema inspects the users table, the related Identity tables, and EF's migration history
+// (__EFMigrationsHistory, or __MigrationHistory for Identity 2) to determine the table's schema.
+// Version 3 has an AspNetUserPasskeys table; version 2 limits the length of PhoneNumber,
+// except in SQLite, whose types have no length, so there only a version 2 upgrade recorded by Migrate shows it.
+// The EF provider is inferred from the Database dialect, and for MySQL from the type of the boolean columns:
+// tinyint(1) for Pomelo, bit(1) for Oracle's provider.
+// Open does this for a Table, which then offers the schema's features; see Table.Schema.
+func DetectSchema(db *sql.DB, table string, style *Database) (*Schema, error) {
+	if style == nil {
+		style = MySQLDatabase
+	}
+	types, err := tableColumns(db, table, style)
+	if err != nil {
+		return nil, err
+	}
+	_, legacy, err := mapColumns(types, nil)
+	if err != nil {
+		return nil, fmt.Errorf("table %s: %v", table, err)
+	}
+	return detectSchema(db, table, style, types, legacy)
+}
+
+// detectSchema implements DetectSchema for a table with the given column types.
+func detectSchema(db *sql.DB, table string, style *Database, types map[string]string, legacy bool) (*Schema, error) {
+	s := &Schema{Version: SchemaVersion1, Provider: efProvider(style, types)}
+	history := relatedTable(table, historyTable)
+	if legacy {
+		s.Version = SchemaIdentity2
+		s.Provider = "EntityFramework"
+		history = relatedTable(table, ef6HistoryTable)
+	}
+	var err error
+	s.Migrations, s.ProductVersion, err = readHistory(db, history, style)
+	if err != nil {
+		return nil, fmt.Errorf("table %s: %v", table, err)
+	}
+	if legacy {
+		return s, nil
+	}
+	if name, ok := findColumn(types, "PhoneNumber"); ok && typeSize(types[name]) != 0 {
+		s.Version = SchemaVersion2
+	}
+	for _, id := range s.Migrations {
+		for v, up := range upgradeMigrations {
+			if id == up && v > s.Version {
+				s.Version = v
+			}
+		}
+	}
+	passkeys, err := listColumns(db, relatedTable(table, "AspNetUserPasskeys"), style)
+	if err != nil {
+		return nil, fmt.Errorf("table %s: %v", table, err)
+	}
+	if len(passkeys) != 0 {
+		s.Version = SchemaVersion3
+	}
+	return s, nil
+}
+
+// efProvider returns the NuGet package name of the EF Core provider for the dialect,
+// given the users table's column types, if known.
+func efProvider(style *Database, types map[string]string) string {
+	switch style.Dialect {
+	case "mysql":
+		if name, ok := findColumn(types, "EmailConfirmed"); ok && containsAny(types[name], "bit") {
+			return "MySql.EntityFrameworkCore"
+		}
+		return "Pomelo.EntityFrameworkCore.MySql"
+	case "postgres":
+		return "Npgsql.EntityFrameworkCore.PostgreSQL"
+	case "sqlserver":
+		return "Microsoft.EntityFrameworkCore.SqlServer"
+	case "sqlite":
+		return "Microsoft.EntityFrameworkCore.Sqlite"
+	}
+	return ""
+}
+
+// Schema returns the table's Identity schema, as found by Open (see DetectSchema).
+// A table made by New or NewTable is assumed to have SchemaVersion1, unless Migrate has since upgraded it.
+// Operations that need a later version than the table's return ErrUnsupported.
+func (tab *Table[T, P]) Schema() Schema {
+	return tab.schema
+}
@@ -0,0 +1,395 @@
+package aspnetusers
+
+// the operations on users, over any storage backend.
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/forsyth/pwdatav3"
+)
+
+// Store is the storage for users represented by values of type P (usually *User).
+// Table is the SQL implementation; others can be plugged in, provided they follow Table's rules,
+// because the operations of this package (NewUser, Authenticate, ChangePassword, the lockout functions)
+// work over any Store, and rely on them.
+type Store[P any] interface {
+	// FindByID returns the user with the given ID, or exactly ErrNotFound.
+	FindByID(id string) (P, error)
+
+	// FindByName returns the user with the given user name, compared in normalised form
+	// (see NormalizedUserName), or exactly ErrNotFound.
+	FindByName(name string) (P, error)
+
+	// Create adds a new user, returning exactly ErrExists if the NormalizedUserName is already registered.
+	// If the user's ID is empty, the store assigns one; otherwise it is kept.
+	Create(u P) error
+
+	// Update replaces the stored user with the same ID, provided its ConcurrencyStamp
+	// matches u's, and gives u a new ConcurrencyStamp. Otherwise it returns exactly ErrConcurrency,
+	// including when the user has been removed. It returns exactly ErrExists if the NormalizedUserName
+	// has changed to one already registered, and exactly ErrNotNormalized if CheckNormalized fails.
+	Update(u P) error
+}
+
+// UserStore is a Store of plain Users.
+type UserStore = Store[*User]
+
+var _ UserStore = (*Users)(nil)
+var _ FailureTracking = (*Users)(nil)
+
+// Lister is implemented by stores that can list all their users, as Table, MemoryStore
+// and boltstore.Store do.
+type Lister[P any] interface {
+	// Each calls fn for each user, in order of ID, stopping at the first error, which it returns.
+	Each(fn func(u P) error) error
+}
+
+// Deleter is implemented by stores that can remove users, as Table, MemoryStore,
+// boltstore.Store and mongostore.Store do.
+type Deleter[P any] interface {
+	// Delete removes the user, provided its ConcurrencyStamp matches u's, with anything else the store
+	// holds for it. Otherwise it returns exactly ErrConcurrency, including when the user has already been removed.
+	Delete(u P) error
+}
+
+// EmailFinder is implemented by stores that can find users by email address,
+// as Table, MemoryStore and boltstore.Store do.
+type EmailFinder[P any] interface {
+	// UsersByEmail returns the users with the given email address, compared in normalised form
+	// (see NormalizedEmail), in order of ID. Unlike user names, email addresses need not be unique.
+	UsersByEmail(email string) ([]P, error)
+}
+
+// FindByEmail returns the one user with the given email address, compared in normalised form.
+// If there is none, the error is exactly ErrNotFound; if there are several, exactly ErrAmbiguous,
+// since a forgotten-password message, for instance, must not go to the wrong account.
+func FindByEmail[P any](s EmailFinder[P], email string) (P, error) {
+	var none P
+	users, err := s.UsersByEmail(email)
+	if err != nil {
+		return none, err
+	}
+	switch len(users) {
+	case 0:
+		return none, ErrNotFound
+	case 1:
+		return users[0], nil
+	}
+	return none, ErrAmbiguous
+}
+
+// Copy adds each user that src lists to dst, with its ID, stamps and other values as they are,
+// to move users between stores; for instance, from an embedded store to the SQL table
+// that a C# application will share.
+// It returns the number of users copied, stopping at the first error.
+func Copy[P any](dst Store[P], src Lister[P]) (int, error) {
+	n := 0
+	err := src.Each(func(u P) error {
+		if err := dst.Create(u); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// NewUser makes a new user entry in the store, returning error ErrExists if the name's already there.
+// Any fields of T beyond User have their zero values; set them with Update.
+func NewUser[T any, P UserType[T]](s Store[P], name, email, password string) (P, error) {
+	u, err := s.FindByName(name)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	if u != nil {
+		//		return nil, ErrExists
+	}
+	if emptyPassword(password) {
+		return nil, ErrNoPassword
+	}
+	pwd, err := pwdatav3.GenerateFromPassword([]byte(password), pwdatav3.DefaultIter)
+	if err != nil {
+		return nil, fmt.Errorf("hashing password: %v", err)
+	}
+	u = P(new(T))
+	*u.IdentityUser() = User{
+		UserName:           name,
+		NormalizedUserName: Normalize(name),
+		PasswordHash:       pwdatav3.EncodeToString(pwd),
+		Email:              email,
+		NormalizedEmail:    Normalize(email),
+		SecurityStamp:      newStamp(),
+		ConcurrencyStamp:   newStamp(),
+	}
+	err = s.Create(u)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Authenticate, given a user name (email) and password, returns either a user identity or an error.
+// If either the authentication fails or the user does not exist, it returns exactly the error ErrInvalidCredentials.
+// The AccessFailedCount counts successive authentication failures, but is reset on the next success;
+// the store is updated only when the count changes, and not at all if s is a FailureTracking store
+// with tracking off.
+func Authenticate[T any, P UserType[T]](s Store[P], name, password string) (P, error) {
+	u, err := s.FindByName(name)
+	if err != nil && err != ErrNotFound {
+		return u, err
+	}
+	return checkPassword(s, u, password)
+}
+
+// SignIn is like Authenticate, but accepts either the user name or the email address of a user,
+// as ASP.NET applications commonly allow. The user name is tried first; failing that, if s is an EmailFinder,
+// an email address registered to just one user. An email address shared by several users
+// cannot be used to sign in, and yields ErrInvalidCredentials as for an unknown user.
+func SignIn[T any, P UserType[T]](s Store[P], login, password string) (P, error) {
+	u, err := s.FindByName(login)
+	if err != nil && err != ErrNotFound {
+		return u, err
+	}
+	if ef, ok := s.(EmailFinder[P]); ok && u == nil {
+		u, err = FindByEmail(ef, login)
+		if err != nil && err != ErrNotFound && err != ErrAmbiguous {
+			return nil, err
+		}
+	}
+	return checkPassword(s, u, password)
+}
+
+// checkPassword checks the password of u, which is nil if the user was not found, for Authenticate and SignIn.
+func checkPassword[T any, P UserType[T]](s Store[P], u P, password string) (P, error) {
+	found := u != nil
+	if !found {
+		// set to a dummy value to avoid over-quick return
+		u = P(new(T))
+		u.IdentityUser().PasswordHash = emptyHash
+	}
+	pwd, err := pwdatav3.DecodeString(u.IdentityUser().PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	// the dummy's empty password must not succeed
+	ok := pwdatav3.CompareHashAndPassword(pwd, []byte(password)) == nil && found
+	accessFailed(s, u, !ok)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+// FailureTracking is implemented by stores, such as Table, that can be told not to track authentication failures,
+// as for a read-only replica of the database. If TrackFailures returns false, Authenticate and SignIn
+// leave AccessFailedCount alone, and never write to the store.
+type FailureTracking interface {
+	TrackFailures() bool
+}
+
+// accessFailed tracks authentication failures but if there's a success, the count is reset.
+// Failures counted meanwhile by another process are kept.
+// The store is written only if the count changes (as in ASP.NET), so that a successful login
+// usually does not change the ConcurrencyStamp.
+func accessFailed[T any, P UserType[T]](s Store[P], u P, bad bool) error {
+	if ft, ok := s.(FailureTracking); ok && !ft.TrackFailures() {
+		return nil
+	}
+	if !bad && u.IdentityUser().AccessFailedCount == 0 {
+		return nil
+	}
+	if u.IdentityUser().ID == "" {
+		// the dummy for an unknown user, whose update fails as a real one's might, but without a retry
+		return s.Update(u)
+	}
+	return retry(s, u, func(nu P) error {
+		if bad {
+			nu.IdentityUser().AccessFailedCount++
+		} else {
+			nu.IdentityUser().AccessFailedCount = 0
+		}
+		return nil
+	})
+}
+
+// ChangePassword tries to update the User's password, rejecting empty ones,
+// and if successful, updates both the value and the store.
+// Both are left unchanged on failure.
+func ChangePassword[T any, P UserType[T]](s Store[P], u P, password string) error {
+	if emptyPassword(password) {
+		return ErrNoPassword
+	}
+	pwd, err := pwdatav3.New(password, pwdatav3.DefaultIter)
+	if err != nil {
+		// it can only be rand.Read failing
+		return fmt.Errorf("change password: %v", err)
+	}
+	text, err := pwd.MarshalText()
+	if err != nil {
+		// can't happen, but j.i.c.
+		return fmt.Errorf("change password: %v", err)
+	}
+	nu := P(new(T))
+	*nu = *u
+	nu.IdentityUser().PasswordHash = string(text)
+	nu.IdentityUser().SecurityStamp = newStamp()
+	err = s.Update(nu)
+	if err != nil {
+		return err
+	}
+	*u = *nu
+	return nil
+}
+
+// CheckNormalized returns ErrNotNormalized unless u's NormalizedUserName and NormalizedEmail are
+// the normalised forms (see Normalize) of its UserName and Email. Every Store's Update checks it.
+func CheckNormalized(u *User) error {
+	if u.NormalizedUserName != Normalize(u.UserName) || u.NormalizedEmail != Normalize(u.Email) {
+		return ErrNotNormalized
+	}
+	return nil
+}
+
+// SetUserName changes the user's name, with its normalised form, and the SecurityStamp, as ASP.NET does,
+// and updates the store. It returns exactly ErrExists if the new name belongs to another user.
+// Both u and the store are left unchanged on failure.
+func SetUserName[T any, P UserType[T]](s Store[P], u P, name string) error {
+	return update(s, u, func(nu *User) {
+		nu.UserName = name
+		nu.NormalizedUserName = Normalize(name)
+		nu.SecurityStamp = newStamp()
+	})
+}
+
+// SetEmail changes the user's email address, with its normalised form, marks it unconfirmed,
+// and changes the SecurityStamp, as ASP.NET does, then updates the store.
+// Both u and the store are left unchanged on failure.
+func SetEmail[T any, P UserType[T]](s Store[P], u P, email string) error {
+	return update(s, u, func(nu *User) {
+		nu.Email = email
+		nu.NormalizedEmail = Normalize(email)
+		nu.EmailConfirmed = false
+		nu.SecurityStamp = newStamp()
+	})
+}
+
+// SetPhoneNumber changes the user's phone number, marks it unconfirmed, and changes the SecurityStamp,
+// as ASP.NET does, then updates the store.
+// Both u and the store are left unchanged on failure.
+func SetPhoneNumber[T any, P UserType[T]](s Store[P], u P, phone string) error {
+	return update(s, u, func(nu *User) {
+		nu.PhoneNumber = phone
+		nu.PhoneNumberConfirmed = false
+		nu.SecurityStamp = newStamp()
+	})
+}
+
+// update applies change to a copy of u, and stores it, updating u only if that succeeds.
+func update[T any, P UserType[T]](s Store[P], u P, change func(nu *User)) error {
+	nu := P(new(T))
+	*nu = *u
+	change(nu.IdentityUser())
+	if err := s.Update(nu); err != nil {
+		return err
+	}
+	*u = *nu
+	return nil
+}
+
+// UpdateFunc fetches the user with the given ID, applies mutate, and stores the result, returning it.
+// If another process has changed the user meanwhile (ErrConcurrency), it fetches the user again and retries,
+// after a short random delay that grows with each attempt, and returns ErrConcurrency only if the
+// last of a few attempts also fails. An error from mutate stops it, and is returned; nothing is stored.
+// Since mutate might be called several times, it must make its changes only to the user it is given.
+func UpdateFunc[T any, P UserType[T]](s Store[P], id string, mutate func(u P) error) (P, error) {
+	for attempt := 1; ; attempt++ {
+		u, err := s.FindByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if err := mutate(u); err != nil {
+			return nil, err
+		}
+		err = s.Update(u)
+		if err == nil {
+			return u, nil
+		}
+		if err != ErrConcurrency || attempt == maxUpdateAttempts {
+			return nil, err
+		}
+		backoff(attempt)
+	}
+}
+
+const (
+	maxUpdateAttempts = 5                    // by UpdateFunc
+	updateBackoff     = 5 * time.Millisecond // initial delay between attempts, doubled each time
+)
+
+// backoff waits before the next attempt of UpdateFunc, for a random time below the current limit,
+// so that clashing processes are unlikely to clash again.
+func backoff(attempt int) {
+	d := updateBackoff << (attempt - 1)
+	time.Sleep(time.Duration(rand.Int63n(int64(d))))
+}
+
+// retry applies change to a copy of u, and stores it, as update does, but if u proves stale (ErrConcurrency),
+// continues as UpdateFunc, applying change to the stored user instead. On success, u is set to the stored user.
+func retry[T any, P UserType[T]](s Store[P], u P, change func(nu P) error) error {
+	nu := P(new(T))
+	*nu = *u
+	if err := change(nu); err != nil {
+		return err
+	}
+	err := s.Update(nu)
+	if err == ErrConcurrency {
+		nu, err = UpdateFunc(s, u.IdentityUser().ID, change)
+	}
+	if err != nil {
+		return err
+	}
+	*u = *nu
+	return nil
+}
+
+// ConfirmEmail marks the user as having confirmed the email address,
+// and updates the stored entry, retrying as UpdateFunc does if u is stale.
+// Both u and the store are left unchanged on failure.
+func ConfirmEmail[T any, P UserType[T]](s Store[P], u P) error {
+	return retry(s, u, func(nu P) error {
+		nu.IdentityUser().EmailConfirmed = true
+		return nil
+	})
+}
+
+// CheckLockout returns an error iff the given user remains locked out from authentication.
+func CheckLockout(u *User) error {
+	if u.LockoutEnabled && u.LockoutEnd != nil && time.Now().Before(*u.LockoutEnd) {
+		return ErrLockedOut
+	}
+	return nil
+}
+
+// ResetLockout resets the lockout mark and timeout for a given user,
+// retrying as UpdateFunc does if u is stale.
+func ResetLockout[T any, P UserType[T]](s Store[P], u P) error {
+	if u.IdentityUser().LockoutEnd == nil {
+		return nil
+	}
+	return retry(s, u, func(nu P) error {
+		nu.IdentityUser().LockoutEnd = nil
+		return nil
+	})
+}
+
+// LockOut locks out the user for the given duration, retrying as UpdateFunc does if u is stale.
+// Both u and the store are left unchanged on failure.
+func LockOut[T any, P UserType[T]](s Store[P], u P, d time.Duration) error {
+	end := time.Now().Add(d).UTC()
+	return retry(s, u, func(nu P) error {
+		nu.IdentityUser().LockoutEnd = &end
+		return nil
+	})
+}
@@ -0,0 +1,629 @@
+// Package storetest checks that an implementation of aspnetusers.Store follows the rules
+// that the operations of package aspnetusers rely on, much as ASP.NET's Identity
+// specification tests check a C# user store. A new store, or a Database adapter for
+// another SQL dialect, can prove its compatibility from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) aspnetusers.UserStore {
+//			return newEmptyStore(t)
+//		})
+//	}
+//
+// RunDatabase does the same for a Database adapter, on a table that it creates with Migrate,
+// and also checks values as other programs might have written them, such as NULL columns.
+package storetest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/forsyth/aspnetusers"
+	"github.com/google/uuid"
+)
+
+// Run checks the stores returned by open, which is called for each subtest and must return an empty store,
+// removing it if need be with t.Cleanup.
+// LockoutEnd must be kept to within a millisecond, the resolution of a BSON date.
+func Run(t *testing.T, open func(t *testing.T) aspnetusers.UserStore) {
+	run(t, open, time.Millisecond)
+}
+
+// RunDatabase checks a Table for the given SQL table and Database adapter, creating the table
+// (and the other Identity tables) with Migrate if need be, and emptying it before each subtest.
+// It runs the checks of Run, but requires LockoutEnd to be kept to within a microsecond,
+// as all the SQL databases do, and also checks that NULL columns become empty strings
+// and that Open recognises the schema Migrate made.
+func RunDatabase(t *testing.T, db *sql.DB, table string, style *aspnetusers.Database) {
+	tab := aspnetusers.New(db, table, style)
+	if _, err := tab.Migrate(aspnetusers.LatestSchema); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	open := func(t *testing.T) aspnetusers.UserStore {
+		if _, err := db.Exec("DELETE FROM " + style.Ident(table)); err != nil {
+			t.Fatalf("empty %s: %v", table, err)
+		}
+		return tab
+	}
+	run(t, open, time.Microsecond)
+
+	t.Run("Nulls", func(t *testing.T) {
+		open(t)
+		testNulls(t, db, table, style, tab)
+	})
+	t.Run("Open", func(t *testing.T) {
+		ot, err := aspnetusers.Open(db, table, style)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		if v := ot.Schema().Version; v != aspnetusers.LatestSchema {
+			t.Errorf("Open: want schema version %d, got %d", aspnetusers.LatestSchema, v)
+		}
+		run(t, func(t *testing.T) aspnetusers.UserStore { open(t); return ot }, time.Microsecond)
+	})
+}
+
+func run(t *testing.T, open func(t *testing.T) aspnetusers.UserStore, precision time.Duration) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s aspnetusers.UserStore, precision time.Duration)
+	}{
+		{"NotFound", testNotFound},
+		{"RoundTrip", testRoundTrip},
+		{"Duplicate", testDuplicate},
+		{"Nameless", testNameless},
+		{"Concurrency", testConcurrency},
+		{"Rename", testRename},
+		{"ConcurrentUpdates", testConcurrentUpdates},
+		{"Operations", testOperations},
+		{"Setters", testSetters},
+		{"Each", testEach},
+		{"Email", testEmail},
+		{"Delete", testDelete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, open(t), precision)
+		})
+	}
+}
+
+// newUser returns a user with the given name and a new ID and stamps, but otherwise zero values.
+func newUser(name string) *aspnetusers.User {
+	return &aspnetusers.User{
+		ID:                 uuid.New().String(),
+		UserName:           name,
+		NormalizedUserName: aspnetusers.Normalize(name),
+		SecurityStamp:      uuid.New().String(),
+		ConcurrencyStamp:   uuid.New().String(),
+	}
+}
+
+// create adds new users with the given names, stopping the test on failure.
+func create(t *testing.T, s aspnetusers.UserStore, names ...string) []*aspnetusers.User {
+	t.Helper()
+	var users []*aspnetusers.User
+	for _, name := range names {
+		u := newUser(name)
+		if err := s.Create(u); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		users = append(users, u)
+	}
+	return users
+}
+
+// same reports whether got is want, as it would be after a round trip through a store
+// that keeps LockoutEnd in UTC to within the given precision.
+func same(got, want *aspnetusers.User, precision time.Duration) error {
+	g, w := *got, *want
+	switch {
+	case g.LockoutEnd == nil && w.LockoutEnd == nil:
+	case g.LockoutEnd == nil || w.LockoutEnd == nil:
+		return fmt.Errorf("LockoutEnd: want %v, got %v", w.LockoutEnd, g.LockoutEnd)
+	case g.LockoutEnd.Location() != time.UTC:
+		return fmt.Errorf("LockoutEnd: want UTC, got %v", g.LockoutEnd.Location())
+	case g.LockoutEnd.Sub(*w.LockoutEnd).Abs() >= precision:
+		return fmt.Errorf("LockoutEnd: want %v, got %v", w.LockoutEnd, g.LockoutEnd)
+	default:
+		g.LockoutEnd = w.LockoutEnd
+	}
+	if g != w {
+		return fmt.Errorf("want %#v, got %#v", &w, &g)
+	}
+	return nil
+}
+
+func testNotFound(t *testing.T, s aspnetusers.UserStore, _ time.Duration) {
+	create(t, s, "Rex@example.com")
+	if _, err := s.FindByID(uuid.New().String()); err != aspnetusers.ErrNotFound {
+		t.Errorf("FindByID of unknown ID: want ErrNotFound, got %v", err)
+	}
+	if _, err := s.FindByName("nobody@example.com"); err != aspnetusers.ErrNotFound {
+		t.Errorf("FindByName of unknown name: want ErrNotFound, got %v", err)
+	}
+}
+
+func testRoundTrip(t *testing.T, s aspnetusers.UserStore, precision time.Duration) {
+	// every field set, with LockoutEnd in another zone and to the nanosecond
+	end := time.Date(2031, 7, 14, 23, 30, 15, 123456789, time.FixedZone("NZST", 12*3600))
+	full := newUser("Rex@example.com")
+	full.Email, full.NormalizedEmail = "rex@example.com", "REX@EXAMPLE.COM"
+	full.EmailConfirmed = true
+	full.PasswordHash = "AQAAAAEAACcQAAAAEHhGT2mW9BMcWhMNA4lNj80h8OULQyuvqbSR99lZ+GWsuhA2H6HLxcZI8+RhtxV5FA=="
+	full.PhoneNumber = "+44 20 7946 0000"
+	full.PhoneNumberConfirmed = true
+	full.TwoFactorEnabled = true
+	full.LockoutEnd = &end
+	full.LockoutEnabled = true
+	full.AccessFailedCount = 3
+
+	// and as few as possible, all false or empty
+	empty := newUser("Spot@example.com")
+	empty.SecurityStamp, empty.ConcurrencyStamp = "", ""
+
+	for _, u := range []*aspnetusers.User{full, empty} {
+		want := *u
+		if err := s.Create(u); err != nil {
+			t.Fatalf("create %s: %v", u.UserName, err)
+		}
+		if u.ID != want.ID {
+			t.Errorf("%s: Create changed the given ID %s to %s", u.UserName, want.ID, u.ID)
+		}
+		got, err := s.FindByID(u.ID)
+		if err != nil {
+			t.Fatalf("%s: FindByID: %v", u.UserName, err)
+		}
+		if err := same(got, &want, precision); err != nil {
+			t.Errorf("%s: FindByID: %v", u.UserName, err)
+		}
+		got, err = s.FindByName(u.UserName)
+		if err != nil {
+			t.Fatalf("%s: FindByName: %v", u.UserName, err)
+		}
+		if err := same(got, &want, precision); err != nil {
+			t.Errorf("%s: FindByName: %v", u.UserName, err)
+		}
+	}
+
+	// an empty ID is assigned
+	u := newUser("Fido@example.com")
+	u.ID = ""
+	if err := s.Create(u); err != nil {
+		t.Fatalf("create with empty ID: %v", err)
+	}
+	if u.ID == "" {
+		t.Fatalf("Create did not assign an ID")
+	}
+	if got, err := s.FindByID(u.ID); err != nil || got.UserName != u.UserName {
+		t.Errorf("FindByID of assigned ID %s: got %v (%v)", u.ID, got, err)
+	}
+}
+
+func testDuplicate(t *testing.T, s aspnetusers.UserStore, _ time.Duration) {
+	u := create(t, s, "Rex@example.com")[0]
+	if err := s.Create(newUser("REX@example.com")); err != aspnetusers.ErrExists {
+		t.Errorf("Create of existing name: want exactly ErrExists, got %v", err)
+	}
+	if _, err := aspnetusers.NewUser(s, "rex@EXAMPLE.com", "rex@example.com", "bone"); err != aspnetusers.ErrExists {
+		t.Errorf("NewUser of existing name: want exactly ErrExists, got %v", err)
+	}
+	if got, err := s.FindByName("rEX@example.COM"); err != nil || got.ID != u.ID {
+		t.Errorf("FindByName ignoring case: got %v (%v)", got, err)
+	}
+}
+
+// testNameless checks that an empty NormalizedUserName is unique like any other,
+// as the SQL table's unique index makes it: one user can have it, and a second gets ErrExists.
+func testNameless(t *testing.T, s aspnetusers.UserStore, _ time.Duration) {
+	u := newUser("")
+	if err := s.Create(u); err != nil {
+		t.Fatalf("Create of user without a name: %v", err)
+	}
+	if err := s.Create(newUser("")); err != aspnetusers.ErrExists {
+		t.Errorf("Create of second user without a name: want exactly ErrExists, got %v", err)
+	}
+	if got, err := s.FindByName(""); err != nil || got.ID != u.ID {
+		t.Errorf("FindByName of empty name: got %v (%v)", got, err)
+	}
+	u.UserName, u.NormalizedUserName = "Rex@example.com", aspnetusers.Normalize("Rex@example.com")
+	if err := s.Update(u); err != nil {
+		t.Fatalf("Update giving a name: %v", err)
+	}
+	if err := s.Create(newUser("")); err != nil {
+		t.Errorf("Create of user without a name, once the first has one: %v", err)
+	}
+}
+
+func testConcurrency(t *testing.T, s aspnetusers.UserStore, precision time.Duration) {
+	u := create(t, s, "Rex@example.com")[0]
+	stale := *u
+	u.PhoneNumber = "555 1234"
+	if err := s.Update(u); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if u.ConcurrencyStamp == stale.ConcurrencyStamp {
+		t.Errorf("Update did not change the ConcurrencyStamp")
+	}
+	stale.PhoneNumber = "555 9999"
+	if err := s.Update(&stale); err != aspnetusers.ErrConcurrency {
+		t.Errorf("Update of stale copy: want exactly ErrConcurrency, got %v", err)
+	}
+	if got, err := s.FindByID(u.ID); err != nil {
+		t.Errorf("FindByID after update: %v", err)
+	} else if err := same(got, u, precision); err != nil {
+		t.Errorf("FindByID after update: %v", err)
+	}
+	if err := s.Update(newUser("Nobody@example.com")); err != aspnetusers.ErrConcurrency {
+		t.Errorf("Update of unknown user: want exactly ErrConcurrency, got %v", err)
+	}
+}
+
+func testRename(t *testing.T, s aspnetusers.UserStore, _ time.Duration) {
+	users := create(t, s, "Rex@example.com", "Spot@example.com")
+	v := users[1]
+	w := *v
+	w.UserName, w.NormalizedUserName = "rex@example.com", "REX@EXAMPLE.COM"
+	if err := s.Update(&w); err != aspnetusers.ErrExists {
+		t.Errorf("rename to existing name: want exactly ErrExists, got %v", err)
+	}
+	v.UserName, v.NormalizedUserName = "Patch@example.com", "PATCH@EXAMPLE.COM"
+	if err := s.Update(v); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if _, err := s.FindByName("Spot@example.com"); err != aspnetusers.ErrNotFound {
+		t.Errorf("FindByName of old name: want ErrNotFound, got %v", err)
+	}
+	if got, err := s.FindByName("patch@example.com"); err != nil || got.ID != v.ID {
+		t.Errorf("FindByName of new name: got %v (%v)", got, err)
+	}
+	// the old name is free again
+	create(t, s, "Spot@example.com")
+}
+
+// testConcurrentUpdates first interleaves the reads and updates of several copies of a user itself,
+// so that it checks the outcome even when the store's connections are serialised
+// (as with db.SetMaxOpenConns(1)), and then races the updates of fresh copies,
+// which tests the store's own locking only where updates can in fact run in parallel.
+func testConcurrentUpdates(t *testing.T, s aspnetusers.UserStore, _ time.Duration) {
+	u := create(t, s, "Rex@example.com")[0]
+	const n = 8
+	find := func(i int) *aspnetusers.User {
+		c, err := s.FindByID(u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.AccessFailedCount = i
+		return c
+	}
+
+	// each copy is read before the previous one is written, so only every other update succeeds
+	prev := find(0)
+	for i := 1; i <= n; i++ {
+		c := find(i)
+		err := s.Update(prev)
+		switch {
+		case i%2 == 1 && err != nil:
+			t.Errorf("update of copy %d: %v", i-1, err)
+		case i%2 == 0 && err != aspnetusers.ErrConcurrency:
+			t.Errorf("update of stale copy %d: want exactly ErrConcurrency, got %v", i-1, err)
+		}
+		prev = c
+	}
+	if got, err := s.FindByID(u.ID); err != nil || got.AccessFailedCount != n-2 {
+		t.Errorf("after interleaved updates: want AccessFailedCount %d, got %v (%v)", n-2, got, err)
+	}
+
+	copies := make([]*aspnetusers.User, n)
+	for i := range copies {
+		copies[i] = find(i)
+	}
+	errs := make(chan error, n)
+	for _, c := range copies {
+		go func(c *aspnetusers.User) { errs <- s.Update(c) }(c)
+	}
+	ok := 0
+	for range copies {
+		switch err := <-errs; err {
+		case nil:
+			ok++
+		case aspnetusers.ErrConcurrency:
+		default:
+			t.Errorf("concurrent update: %v", err)
+		}
+	}
+	if ok != 1 {
+		t.Errorf("concurrent updates: %d succeeded, want 1", ok)
+	}
+}
+
+func testOperations(t *testing.T, s aspnetusers.UserStore, _ time.Duration) {
+	u, err := aspnetusers.NewUser(s, "Rex@example.com", "rex@example.com", "bone")
+	if err != nil {
+		t.Fatalf("NewUser: %v", err)
+	}
+	if _, err := aspnetusers.Authenticate(s, "rex@example.com", "ball"); err != aspnetusers.ErrInvalidCredentials {
+		t.Errorf("Authenticate with wrong password: want ErrInvalidCredentials, got %v", err)
+	}
+	if _, err := aspnetusers.Authenticate(s, "nobody@example.com", "bone"); err != aspnetusers.ErrInvalidCredentials {
+		t.Errorf("Authenticate of unknown user: want ErrInvalidCredentials, got %v", err)
+	}
+	if got, err := s.FindByID(u.ID); err != nil || got.AccessFailedCount != 1 {
+		t.Errorf("AccessFailedCount after failure: want 1, got %v (%v)", got, err)
+	}
+	u, err = aspnetusers.Authenticate(s, "REX@example.com", "bone")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if u.AccessFailedCount != 0 {
+		t.Errorf("AccessFailedCount after success: want 0, got %d", u.AccessFailedCount)
+	}
+
+	stamp := u.SecurityStamp
+	if err := aspnetusers.ChangePassword(s, u, "stick"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if u.SecurityStamp == stamp {
+		t.Errorf("ChangePassword did not change the SecurityStamp")
+	}
+	if _, err := aspnetusers.Authenticate(s, "rex@example.com", "bone"); err != aspnetusers.ErrInvalidCredentials {
+		t.Errorf("Authenticate with old password: want ErrInvalidCredentials, got %v", err)
+	}
+	u, err = aspnetusers.Authenticate(s, "rex@example.com", "stick")
+	if err != nil {
+		t.Fatalf("Authenticate with new password: %v", err)
+	}
+
+	if err := aspnetusers.ConfirmEmail(s, u); err != nil {
+		t.Fatalf("ConfirmEmail: %v", err)
+	}
+	u.LockoutEnabled = true
+	if err := aspnetusers.LockOut(s, u, time.Hour); err != nil {
+		t.Fatalf("LockOut: %v", err)
+	}
+	got, err := s.FindByID(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.EmailConfirmed {
+		t.Errorf("ConfirmEmail was not stored")
+	}
+	if err := aspnetusers.CheckLockout(got); err != aspnetusers.ErrLockedOut {
+		t.Errorf("CheckLockout after LockOut: want ErrLockedOut, got %v", err)
+	}
+	if err := aspnetusers.ResetLockout(s, got); err != nil {
+		t.Fatalf("ResetLockout: %v", err)
+	}
+	if got, err = s.FindByID(u.ID); err != nil || aspnetusers.CheckLockout(got) != nil {
+		t.Errorf("CheckLockout after ResetLockout: got %v (%v)", got, err)
+	}
+}
+
+func testSetters(t *testing.T, s aspnetusers.UserStore, precision time.Duration) {
+	users := create(t, s, "Rex@example.com", "Spot@example.com")
+	u := users[0]
+
+	// Update refuses inconsistent Normalized fields
+	bad := *u
+	bad.UserName = "Fido@example.com"
+	if err := s.Update(&bad); err != aspnetusers.ErrNotNormalized {
+		t.Errorf("Update with stale NormalizedUserName: want exactly ErrNotNormalized, got %v", err)
+	}
+	bad = *u
+	bad.Email = "fido@example.com"
+	if err := s.Update(&bad); err != aspnetusers.ErrNotNormalized {
+		t.Errorf("Update with stale NormalizedEmail: want exactly ErrNotNormalized, got %v", err)
+	}
+
+	u.EmailConfirmed, u.PhoneNumberConfirmed = true, true
+	if err := s.Update(u); err != nil {
+		t.Fatal(err)
+	}
+	stamp := u.SecurityStamp
+	if err := aspnetusers.SetUserName(s, u, "Fido@example.com"); err != nil {
+		t.Fatalf("SetUserName: %v", err)
+	}
+	if u.UserName != "Fido@example.com" || u.NormalizedUserName != "FIDO@EXAMPLE.COM" || u.SecurityStamp == stamp {
+		t.Errorf("SetUserName: got %#v", u)
+	}
+	if got, err := s.FindByName("fido@example.com"); err != nil || got.ID != u.ID {
+		t.Errorf("FindByName of new name: got %v (%v)", got, err)
+	}
+	before := *u
+	if err := aspnetusers.SetUserName(s, u, "SPOT@example.com"); err != aspnetusers.ErrExists {
+		t.Errorf("SetUserName to existing name: want exactly ErrExists, got %v", err)
+	}
+	if *u != before {
+		t.Errorf("SetUserName changed the user on failure: %#v", u)
+	}
+
+	stamp = u.SecurityStamp
+	if err := aspnetusers.SetEmail(s, u, "Fido@Example.com"); err != nil {
+		t.Fatalf("SetEmail: %v", err)
+	}
+	if u.Email != "Fido@Example.com" || u.NormalizedEmail != "FIDO@EXAMPLE.COM" || u.EmailConfirmed || u.SecurityStamp == stamp {
+		t.Errorf("SetEmail: got %#v", u)
+	}
+	stamp = u.SecurityStamp
+	if err := aspnetusers.SetPhoneNumber(s, u, "+44 20 7946 0000"); err != nil {
+		t.Fatalf("SetPhoneNumber: %v", err)
+	}
+	if u.PhoneNumber != "+44 20 7946 0000" || u.PhoneNumberConfirmed || u.SecurityStamp == stamp {
+		t.Errorf("SetPhoneNumber: got %#v", u)
+	}
+	if got, err := s.FindByID(u.ID); err != nil {
+		t.Errorf("FindByID: %v", err)
+	} else if err := same(got, u, precision); err != nil {
+		t.Errorf("FindByID after setters: %v", err)
+	}
+}
+
+// testEach checks that a store that can list its users lists each just once,
+// and stops at an error.
+func testEach(t *testing.T, s aspnetusers.UserStore, _ time.Duration) {
+	l, ok := s.(aspnetusers.Lister[*aspnetusers.User])
+	if !ok {
+		t.Skip("store is not a Lister")
+	}
+	users := create(t, s, "Rex@example.com", "Spot@example.com", "Fido@example.com")
+	var want, got []string
+	for _, u := range users {
+		want = append(want, u.ID)
+	}
+	err := l.Each(func(u *aspnetusers.User) error {
+		got = append(got, u.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Each: %v", err)
+	}
+	sort.Strings(want)
+	sort.Strings(got)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Each: want IDs %v, got %v", want, got)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = l.Each(func(*aspnetusers.User) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("Each: want to stop with the first error, got %v after %d users", err, n)
+	}
+}
+
+// testEmail checks a store that can find users by email address, and SignIn.
+func testEmail(t *testing.T, s aspnetusers.UserStore, _ time.Duration) {
+	ef, ok := s.(aspnetusers.EmailFinder[*aspnetusers.User])
+	if !ok {
+		t.Skip("store is not an EmailFinder")
+	}
+	rex, err := aspnetusers.NewUser(s, "Rex", "Rex@example.com", "bone")
+	if err != nil {
+		t.Fatalf("NewUser: %v", err)
+	}
+	for _, name := range []string{"Spot", "Patch"} {
+		if _, err := aspnetusers.NewUser(s, name, "dogs@example.com", "ball"); err != nil {
+			t.Fatalf("NewUser: %v", err)
+		}
+	}
+	if users, err := ef.UsersByEmail("REX@example.com"); err != nil || len(users) != 1 || users[0].ID != rex.ID {
+		t.Errorf("UsersByEmail: want just Rex, got %v (%v)", users, err)
+	}
+	users, err := ef.UsersByEmail("Dogs@Example.com")
+	if err != nil || len(users) != 2 || users[0].ID > users[1].ID {
+		t.Errorf("UsersByEmail of shared address: want 2 users in order of ID, got %v (%v)", users, err)
+	}
+	if users, err := ef.UsersByEmail("nobody@example.com"); err != nil || len(users) != 0 {
+		t.Errorf("UsersByEmail of unknown address: want none, got %v (%v)", users, err)
+	}
+	if u, err := aspnetusers.FindByEmail(ef, "rex@EXAMPLE.com"); err != nil || u.ID != rex.ID {
+		t.Errorf("FindByEmail: want Rex, got %v (%v)", u, err)
+	}
+	if _, err := aspnetusers.FindByEmail(ef, "dogs@example.com"); err != aspnetusers.ErrAmbiguous {
+		t.Errorf("FindByEmail of shared address: want ErrAmbiguous, got %v", err)
+	}
+	if _, err := aspnetusers.FindByEmail(ef, "nobody@example.com"); err != aspnetusers.ErrNotFound {
+		t.Errorf("FindByEmail of unknown address: want ErrNotFound, got %v", err)
+	}
+
+	for _, login := range []string{"rex", "rex@example.com"} {
+		if u, err := aspnetusers.SignIn(s, login, "bone"); err != nil || u.ID != rex.ID {
+			t.Errorf("SignIn as %s: want Rex, got %v (%v)", login, u, err)
+		}
+		if _, err := aspnetusers.SignIn(s, login, "ball"); err != aspnetusers.ErrInvalidCredentials {
+			t.Errorf("SignIn as %s with wrong password: want ErrInvalidCredentials, got %v", login, err)
+		}
+	}
+	if _, err := aspnetusers.SignIn(s, "dogs@example.com", "ball"); err != aspnetusers.ErrInvalidCredentials {
+		t.Errorf("SignIn with shared address: want ErrInvalidCredentials, got %v", err)
+	}
+	if u, err := aspnetusers.SignIn(s, "Spot", "ball"); err != nil || u.UserName != "Spot" {
+		t.Errorf("SignIn by name with shared address: got %v (%v)", u, err)
+	}
+}
+
+// testDelete checks a store that can remove users.
+func testDelete(t *testing.T, s aspnetusers.UserStore, _ time.Duration) {
+	d, ok := s.(aspnetusers.Deleter[*aspnetusers.User])
+	if !ok {
+		t.Skip("store is not a Deleter")
+	}
+	users := create(t, s, "Rex@example.com", "Spot@example.com")
+	u := users[0]
+	stale := *u
+	if err := aspnetusers.ConfirmEmail(s, u); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete(&stale); err != aspnetusers.ErrConcurrency {
+		t.Errorf("Delete of stale copy: want exactly ErrConcurrency, got %v", err)
+	}
+	if err := d.Delete(u); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.FindByID(u.ID); err != aspnetusers.ErrNotFound {
+		t.Errorf("FindByID after Delete: want ErrNotFound, got %v", err)
+	}
+	if _, err := s.FindByName(u.UserName); err != aspnetusers.ErrNotFound {
+		t.Errorf("FindByName after Delete: want ErrNotFound, got %v", err)
+	}
+	if err := d.Delete(u); err != aspnetusers.ErrConcurrency {
+		t.Errorf("second Delete: want exactly ErrConcurrency, got %v", err)
+	}
+	if _, err := s.FindByID(users[1].ID); err != nil {
+		t.Errorf("FindByID of other user: %v", err)
+	}
+	// the name can be used again
+	create(t, s, "Rex@example.com")
+}
+
+// testNulls checks that a row written by another program, with NULL in every nullable column,
+// reads as a User with empty strings.
+func testNulls(t *testing.T, db *sql.DB, table string, style *aspnetusers.Database, tab *aspnetusers.Users) {
+	cols := []string{"Id", "UserName", "NormalizedUserName", "EmailConfirmed", "PhoneNumberConfirmed", "TwoFactorEnabled", "LockoutEnabled", "AccessFailedCount"}
+	want := newUser("Rex@example.com")
+	want.SecurityStamp, want.ConcurrencyStamp = "", ""
+	want.EmailConfirmed, want.TwoFactorEnabled = true, true
+	args := []any{want.ID, want.UserName, want.NormalizedUserName, true, false, true, false, 0}
+	var names, params string
+	for i, c := range cols {
+		if i > 0 {
+			names += ", "
+			params += ", "
+		}
+		names += style.Ident(c)
+		params += style.Param(i + 1)
+	}
+	_, err := db.Exec("INSERT INTO "+style.Ident(table)+" ("+names+") VALUES ("+params+")", args...)
+	if err != nil {
+		t.Fatalf("insert row with NULLs: %v", err)
+	}
+	got, err := tab.FindByID(want.ID)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if err := same(got, want, time.Microsecond); err != nil {
+		t.Errorf("FindByID: %v", err)
+	}
+
+	// a NULL ConcurrencyStamp, read as empty, matches the empty stamp
+	stale := *got
+	got.PhoneNumber = "555 1234"
+	if err := tab.Update(got); err != nil {
+		t.Errorf("Update with NULL ConcurrencyStamp: %v", err)
+	}
+	if err := tab.Delete(&stale); err != aspnetusers.ErrConcurrency {
+		t.Errorf("Delete of stale copy: want exactly ErrConcurrency, got %v", err)
+	}
+	if _, err := db.Exec("UPDATE " + style.Ident(table) + " SET " + style.Ident("ConcurrencyStamp") + " = NULL"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tab.Delete(&stale); err != nil {
+		t.Errorf("Delete with NULL ConcurrencyStamp: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package storetest
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/forsyth/aspnetusers"
+	"github.com/forsyth/aspnetusers/internal/testdb"
+	_ "github.com/go-sql-driver/mysql"
+	_ "modernc.org/sqlite"
+)
+
+func TestMemoryStore(t *testing.T) {
+	Run(t, func(t *testing.T) aspnetusers.UserStore {
+		return aspnetusers.NewMemoryStore[aspnetusers.User]()
+	})
+}
+
+func TestSQLite(t *testing.T) {
+	db := openDB(t, "sqlite", filepath.Join(t.TempDir(), "aspnet.db"))
+	db.SetMaxOpenConns(1) // SQLite has one writer
+	RunDatabase(t, db, "AspNetUsers", aspnetusers.SQLiteDatabase)
+}
+
+// TestUnquoted checks the harness with an adapter that leaves names unquoted, as a nil Quote may.
+func TestUnquoted(t *testing.T) {
+	db := openDB(t, "sqlite", filepath.Join(t.TempDir(), "aspnet.db"))
+	db.SetMaxOpenConns(1)
+	style := *aspnetusers.SQLiteDatabase
+	style.Quote = nil
+	RunDatabase(t, db, "AspNetUsers", &style)
+}
+
+// TestMySQL uses only the in-memory test server of package internal/testdb: Migrate's tables would get in the way of
+// the root package's tests on a shared MySQL, PostgreSQL or SQL Server test database.
+func TestMySQL(t *testing.T) {
+	db := openDB(t, "mysql", testdb.MySQL(t))
+	// that server does not isolate concurrent updates, so ConcurrentUpdates
+	// checks only its interleaved updates here, not the race
+	db.SetMaxOpenConns(1)
+	RunDatabase(t, db, "AspNetUsers", aspnetusers.MySQLDatabase)
+}
+
+func openDB(t *testing.T, driver, dsn string) *sql.DB {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,6 @@
+INSERT INTO "AspNetUsers" ("Id", "Email", "EmailConfirmed", "PasswordHash", "SecurityStamp", "PhoneNumber", "PhoneNumberConfirmed", "TwoFactorEnabled", "LockoutEndDateUtc", "LockoutEnabled", "AccessFailedCount", "UserName") VALUES
+	('02aa6071-58de-46ba-923c-726c7433b78c','josephine@example.com',0,'AQAAAAEAACcQAAAAEO4k5r1SgFuCYAS8xfu/Mnu5iZUqh+DgSRU4IyJpD+mVo4KdbI1BwiF3KcY1V6AapQ==','7U224TTYHE6VI2LUDQ6LVCWVEJ6UUZ7L',NULL,0,0,NULL,1,0,'josephine@example.com'),
+	('3f7ec9a8-443c-4864-9366-b5fa6e5d6930','joseph@example.com',0,'AQAAAAEAACcQAAAAEE0qQFDCDkOmkdayxh4I25EhS8BCNpJoFisWryZ+7NEvYolOW3VvM7NvPShuhLjYig==','YOGKNXEAS46JX2Z4MGI4BADFIQPEIRR4',NULL,0,0,NULL,1,0,'joseph@example.com'),
+	('5ec290a6-eb9b-4542-a5ea-70898686cb26','jenny@example.com',0,'AQAAAAEAACcQAAAAEIlFLZh4m/vpVzA1RepTfygQZ5g144Ny0jWN57lgJ9gNnSrUcDGL7ce75I0pCaHJkw==','Q2RFTJFX3YMUTK4LLA7WYE6W42JB2E63',NULL,0,0,NULL,1,0,'jenny@example.com'),
+	('ab6c3f50-e783-4ee1-bb7a-c9b227b76d42','frodo@sauron.com',0,'AQAAAAEAACcQAAAAEDwi80lZ8tyhpsTMaSt/bGAhHJn7CT6ia337VgBMVHj4osyPjvt3KjLa6cPCDA9s9g==','6e195f45-00f9-41fb-814a-19adcc2f17b4',NULL,0,0,NULL,1,0,'frodo@sauron.com'),
+	('b1f9c65c-5788-4541-a9df-71575538c10e','jake@example.com',0,'AQAAAAEAACcQAAAAEHhGT2mW9BMcWhMNA4lNj80h8OULQyuvqbSR99lZ+GWsuhA2H6HLxcZI8+RhtxV5FA==','XK4KFSOOIGKZJZLJZKUTIZ6HJKD2O3JE',NULL,0,0,NULL,1,0,'jake@example.com');
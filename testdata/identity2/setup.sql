@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS "AspNetUsers";
+CREATE TABLE "AspNetUsers" (
+    "Id" TEXT NOT NULL PRIMARY KEY,
+    "Email" TEXT NULL,
+    "EmailConfirmed" INTEGER NOT NULL,
+    "PasswordHash" TEXT NULL,
+    "SecurityStamp" TEXT NULL,
+    "PhoneNumber" TEXT NULL,
+    "PhoneNumberConfirmed" INTEGER NOT NULL,
+    "TwoFactorEnabled" INTEGER NOT NULL,
+    "LockoutEndDateUtc" DATETIME NULL,
+    "LockoutEnabled" INTEGER NOT NULL,
+    "AccessFailedCount" INTEGER NOT NULL,
+    "UserName" TEXT NOT NULL COLLATE NOCASE
+);
+CREATE UNIQUE INDEX "UserNameIndex" ON "AspNetUsers" ("UserName");
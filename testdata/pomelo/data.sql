@@ -0,0 +1,6 @@
+INSERT INTO `AspNetUsers` (`Id`, `AccessFailedCount`, `ConcurrencyStamp`, `Email`, `EmailConfirmed`, `LockoutEnabled`, `LockoutEnd`, `NormalizedEmail`, `NormalizedUserName`, `PasswordHash`, `PhoneNumber`, `PhoneNumberConfirmed`, `SecurityStamp`, `TwoFactorEnabled`, `UserName`) VALUES
+	('02aa6071-58de-46ba-923c-726c7433b78c',0,'281c2486-402b-4baa-9030-b68406ea853f','josephine@example.com',0,1,NULL,'JOSEPHINE@EXAMPLE.COM','JOSEPHINE@EXAMPLE.COM','AQAAAAEAACcQAAAAEO4k5r1SgFuCYAS8xfu/Mnu5iZUqh+DgSRU4IyJpD+mVo4KdbI1BwiF3KcY1V6AapQ==',NULL,0,'7U224TTYHE6VI2LUDQ6LVCWVEJ6UUZ7L',0,'josephine@example.com'),
+	('3f7ec9a8-443c-4864-9366-b5fa6e5d6930',0,'c37ba7f9-16fd-4cc5-b388-f7a48d1ce0fb','joseph@example.com',0,1,NULL,'JOSEPH@EXAMPLE.COM','JOSEPH@EXAMPLE.COM','AQAAAAEAACcQAAAAEE0qQFDCDkOmkdayxh4I25EhS8BCNpJoFisWryZ+7NEvYolOW3VvM7NvPShuhLjYig==',NULL,0,'YOGKNXEAS46JX2Z4MGI4BADFIQPEIRR4',0,'joseph@example.com'),
+	('5ec290a6-eb9b-4542-a5ea-70898686cb26',0,'3fcdaba7-c47a-42f8-a856-64815f787d6d','jenny@example.com',0,1,NULL,'JENNY@EXAMPLE.COM','JENNY@EXAMPLE.COM','AQAAAAEAACcQAAAAEIlFLZh4m/vpVzA1RepTfygQZ5g144Ny0jWN57lgJ9gNnSrUcDGL7ce75I0pCaHJkw==',NULL,0,'Q2RFTJFX3YMUTK4LLA7WYE6W42JB2E63',0,'jenny@example.com'),
+	('ab6c3f50-e783-4ee1-bb7a-c9b227b76d42',0,'75b854aa-4cf3-4003-9baa-631ce4079a0f','frodo@sauron.com',0,1,NULL,'FRODO@SAURON.COM','FRODO@SAURON.COM','AQAAAAEAACcQAAAAEDwi80lZ8tyhpsTMaSt/bGAhHJn7CT6ia337VgBMVHj4osyPjvt3KjLa6cPCDA9s9g==',NULL,0,'6e195f45-00f9-41fb-814a-19adcc2f17b4',0,'frodo@sauron.com'),
+	('b1f9c65c-5788-4541-a9df-71575538c10e',0,'b776ee20-95fc-48f9-a756-020781b3f567','jake@example.com',0,1,NULL,'JAKE@EXAMPLE.COM','JAKE@EXAMPLE.COM','AQAAAAEAACcQAAAAEHhGT2mW9BMcWhMNA4lNj80h8OULQyuvqbSR99lZ+GWsuhA2H6HLxcZI8+RhtxV5FA==',NULL,0,'XK4KFSOOIGKZJZLJZKUTIZ6HJKD2O3JE',0,'jake@example.com');
@@ -0,0 +1,21 @@
+DROP TABLE IF EXISTS `AspNetUsers`;
+CREATE TABLE `AspNetUsers` (
+  `Id` char(36) CHARACTER SET ascii COLLATE ascii_general_ci NOT NULL,
+  `UserName` varchar(256) CHARACTER SET utf8mb4 NULL,
+  `NormalizedUserName` varchar(256) CHARACTER SET utf8mb4 NULL,
+  `Email` varchar(256) CHARACTER SET utf8mb4 NULL,
+  `NormalizedEmail` varchar(256) CHARACTER SET utf8mb4 NULL,
+  `EmailConfirmed` tinyint(1) NOT NULL,
+  `PasswordHash` longtext CHARACTER SET utf8mb4 NULL,
+  `SecurityStamp` longtext CHARACTER SET utf8mb4 NULL,
+  `ConcurrencyStamp` longtext CHARACTER SET utf8mb4 NULL,
+  `PhoneNumber` longtext CHARACTER SET utf8mb4 NULL,
+  `PhoneNumberConfirmed` tinyint(1) NOT NULL,
+  `TwoFactorEnabled` tinyint(1) NOT NULL,
+  `LockoutEnd` datetime(6) NULL,
+  `LockoutEnabled` tinyint(1) NOT NULL,
+  `AccessFailedCount` int NOT NULL,
+  CONSTRAINT `PK_AspNetUsers` PRIMARY KEY (`Id`)
+) CHARACTER SET=utf8mb4;
+CREATE INDEX `EmailIndex` ON `AspNetUsers` (`NormalizedEmail`);
+CREATE UNIQUE INDEX `UserNameIndex` ON `AspNetUsers` (`NormalizedUserName`);
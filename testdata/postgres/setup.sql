@@ -0,0 +1,21 @@
+DROP TABLE IF EXISTS "AspNetUsers";
+CREATE TABLE "AspNetUsers" (
+  "Id" text NOT NULL,
+  "UserName" character varying(256) NULL,
+  "NormalizedUserName" character varying(256) NULL,
+  "Email" character varying(256) NULL,
+  "NormalizedEmail" character varying(256) NULL,
+  "EmailConfirmed" boolean NOT NULL,
+  "PasswordHash" text NULL,
+  "SecurityStamp" text NULL,
+  "ConcurrencyStamp" text NULL,
+  "PhoneNumber" text NULL,
+  "PhoneNumberConfirmed" boolean NOT NULL,
+  "TwoFactorEnabled" boolean NOT NULL,
+  "LockoutEnd" timestamp with time zone NULL,
+  "LockoutEnabled" boolean NOT NULL,
+  "AccessFailedCount" integer NOT NULL,
+  CONSTRAINT "PK_AspNetUsers" PRIMARY KEY ("Id")
+);
+CREATE INDEX "EmailIndex" ON "AspNetUsers" ("NormalizedEmail");
+CREATE UNIQUE INDEX "UserNameIndex" ON "AspNetUsers" ("NormalizedUserName");
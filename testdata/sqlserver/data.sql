@@ -0,0 +1,6 @@
+INSERT INTO [dbo].[AspNetUsers] ([Id], [AccessFailedCount], [ConcurrencyStamp], [Email], [EmailConfirmed], [LockoutEnabled], [LockoutEnd], [NormalizedEmail], [NormalizedUserName], [PasswordHash], [PhoneNumber], [PhoneNumberConfirmed], [SecurityStamp], [TwoFactorEnabled], [UserName]) VALUES
+	(N'02aa6071-58de-46ba-923c-726c7433b78c',0,N'281c2486-402b-4baa-9030-b68406ea853f',N'josephine@example.com',0,1,NULL,N'JOSEPHINE@EXAMPLE.COM',N'JOSEPHINE@EXAMPLE.COM',N'AQAAAAEAACcQAAAAEO4k5r1SgFuCYAS8xfu/Mnu5iZUqh+DgSRU4IyJpD+mVo4KdbI1BwiF3KcY1V6AapQ==',NULL,0,N'7U224TTYHE6VI2LUDQ6LVCWVEJ6UUZ7L',0,N'josephine@example.com'),
+	(N'3f7ec9a8-443c-4864-9366-b5fa6e5d6930',0,N'c37ba7f9-16fd-4cc5-b388-f7a48d1ce0fb',N'joseph@example.com',0,1,NULL,N'JOSEPH@EXAMPLE.COM',N'JOSEPH@EXAMPLE.COM',N'AQAAAAEAACcQAAAAEE0qQFDCDkOmkdayxh4I25EhS8BCNpJoFisWryZ+7NEvYolOW3VvM7NvPShuhLjYig==',NULL,0,N'YOGKNXEAS46JX2Z4MGI4BADFIQPEIRR4',0,N'joseph@example.com'),
+	(N'5ec290a6-eb9b-4542-a5ea-70898686cb26',0,N'3fcdaba7-c47a-42f8-a856-64815f787d6d',N'jenny@example.com',0,1,NULL,N'JENNY@EXAMPLE.COM',N'JENNY@EXAMPLE.COM',N'AQAAAAEAACcQAAAAEIlFLZh4m/vpVzA1RepTfygQZ5g144Ny0jWN57lgJ9gNnSrUcDGL7ce75I0pCaHJkw==',NULL,0,N'Q2RFTJFX3YMUTK4LLA7WYE6W42JB2E63',0,N'jenny@example.com'),
+	(N'ab6c3f50-e783-4ee1-bb7a-c9b227b76d42',0,N'75b854aa-4cf3-4003-9baa-631ce4079a0f',N'frodo@sauron.com',0,1,NULL,N'FRODO@SAURON.COM',N'FRODO@SAURON.COM',N'AQAAAAEAACcQAAAAEDwi80lZ8tyhpsTMaSt/bGAhHJn7CT6ia337VgBMVHj4osyPjvt3KjLa6cPCDA9s9g==',NULL,0,N'6e195f45-00f9-41fb-814a-19adcc2f17b4',0,N'frodo@sauron.com'),
+	(N'b1f9c65c-5788-4541-a9df-71575538c10e',0,N'b776ee20-95fc-48f9-a756-020781b3f567',N'jake@example.com',0,1,NULL,N'JAKE@EXAMPLE.COM',N'JAKE@EXAMPLE.COM',N'AQAAAAEAACcQAAAAEHhGT2mW9BMcWhMNA4lNj80h8OULQyuvqbSR99lZ+GWsuhA2H6HLxcZI8+RhtxV5FA==',NULL,0,N'XK4KFSOOIGKZJZLJZKUTIZ6HJKD2O3JE',0,N'jake@example.com');
@@ -0,0 +1,201 @@
+package aspnetusers
+
+// updating just the columns that have changed since a user was read.
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tracked is a user read by Track, with a snapshot of the user as read,
+// so that UpdateTracked can write only the columns that the caller has changed since.
+type Tracked[T any, P UserType[T]] struct {
+	User P // to be changed as required
+
+	// the snapshot holds the columns' values in text form, so that it shares nothing
+	// (such as LockoutEnd's time) with User
+	id       string
+	stamp    string   // ConcurrencyStamp
+	snapshot []string // text of each column's value
+}
+
+// ConflictError is returned by UpdateTracked when another process has changed the user since it was read.
+// Fields names the columns changed by both, or with the ConcurrencyStamp checked, all those changed by the other process.
+// errors.Is(err, ErrConcurrency) is true of a ConflictError.
+type ConflictError struct {
+	Fields []string
+}
+
+func (e *ConflictError) Error() string {
+	if len(e.Fields) == 0 {
+		return ErrConcurrency.Error()
+	}
+	return ErrConcurrency.Error() + ": " + strings.Join(e.Fields, ", ")
+}
+
+// Is reports whether target is ErrConcurrency.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConcurrency
+}
+
+// Track returns the user with the given ID, as FindByID does, tracked for UpdateTracked.
+func (tab *Table[T, P]) Track(id string) (*Tracked[T, P], error) {
+	u, err := tab.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tracked[T, P]{User: u}
+	t.take(tab)
+	return t, nil
+}
+
+// take makes the snapshot of t.User, as just read from tab.
+func (t *Tracked[T, P]) take(tab *Table[T, P]) {
+	iu := t.User.IdentityUser()
+	t.id, t.stamp = iu.ID, iu.ConcurrencyStamp
+	t.snapshot = make([]string, len(tab.columns))
+	for i := range tab.columns {
+		t.snapshot[i] = tab.columns[i].text(t.User)
+	}
+}
+
+// UpdateTracked writes to the table the columns of t.User that differ from those of the snapshot taken by Track,
+// leaving the others as another process (such as the C# application) might have set them meanwhile,
+// and does nothing if there are none. On success, t.User and its snapshot become the user as now stored,
+// including any changes made meanwhile by others.
+//
+// If checkStamp is true, the ConcurrencyStamp must still be that of the snapshot, as for Update,
+// and it is changed, as Update changes it.
+// Otherwise, the ConcurrencyStamp is neither checked nor changed, and the update fails only if another process
+// has changed one of the same columns to a different value; other processes' copies of the user remain current.
+// That suits the counters and flags of authentication, such as AccessFailedCount, which should not
+// invalidate the copy of a user that the C# application is editing.
+// Either way, a concurrent change yields a *ConflictError naming the columns affected,
+// and a concurrent removal exactly ErrConcurrency.
+// UpdateTracked otherwise returns errors as Update does.
+func (tab *Table[T, P]) UpdateTracked(t *Tracked[T, P], checkStamp bool) error {
+	u := t.User
+	iu := u.IdentityUser()
+	if err := CheckNormalized(iu); err != nil {
+		return err
+	}
+	if tab.schema.Version >= SchemaVersion2 && utf8.RuneCountInString(iu.PhoneNumber) > 256 {
+		return ErrTooLong
+	}
+	if iu.ID != t.id {
+		return fmt.Errorf("update user: ID changed from %s to %s", t.id, iu.ID)
+	}
+	ours := tab.changed(t.snapshot, u)
+	if len(ours) == 0 {
+		return nil
+	}
+	id, err := tab.key.Arg(iu.ID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := tab.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	cur, err := tab.unpackUser(tx.QueryRow(tab.queryLock, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrConcurrency
+		}
+		return fmt.Errorf("update user: %v", err)
+	}
+	theirs := tab.changed(t.snapshot, cur)
+	if checkStamp {
+		if cur.IdentityUser().ConcurrencyStamp != t.stamp {
+			return &ConflictError{Fields: tab.columnNamesOf(theirs)}
+		}
+	} else {
+		var clash []int
+		for _, i := range theirs {
+			c := &tab.columns[i]
+			if contains(ours, i) && c.text(cur) != c.text(u) {
+				clash = append(clash, i)
+			}
+		}
+		if len(clash) > 0 {
+			return &ConflictError{Fields: tab.columnNamesOf(clash)}
+		}
+	}
+
+	db := tab.style
+	var sets []string
+	var args []any
+	for _, i := range ours {
+		args = append(args, tab.columns[i].value(db, u))
+		sets = append(sets, db.Ident(tab.columns[i].name)+"="+db.Param(len(args)))
+	}
+	stampColumn, stamp := "ConcurrencyStamp", cur.IdentityUser().ConcurrencyStamp
+	if tab.legacy {
+		// as in updateLegacy
+		stampColumn, stamp = "SecurityStamp", cur.IdentityUser().SecurityStamp
+	} else if checkStamp {
+		args = append(args, newStamp())
+		sets = append(sets, db.Ident(tab.col("ConcurrencyStamp"))+"="+db.Param(len(args)))
+	}
+	args = append(args, id, stamp)
+	res, err := tx.Exec(db.cmd("UPDATE", ident(tab.table), "SET", strings.Join(sets, ", "),
+		"WHERE", ident(tab.col("Id")), "=", db.Param(len(args)-1), "AND", tab.stampIs(stampColumn, len(args))), args...)
+	if err != nil {
+		if db.IsDuplicate(err) {
+			return ErrExists
+		}
+		return fmt.Errorf("update user: %v", err)
+	}
+	nr, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if nr == 0 {
+		// changed since read in this transaction, by a database that does not lock the row
+		return ErrConcurrency
+	}
+	nu, err := tab.unpackUser(tx.QueryRow(tab.queryLock, id))
+	if err != nil {
+		return fmt.Errorf("update user: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	*u = *nu
+	t.take(tab)
+	return nil
+}
+
+// changed returns the indexes of the columns, other than ConcurrencyStamp, whose values in u differ from those of the snapshot.
+func (tab *Table[T, P]) changed(snapshot []string, u P) []int {
+	var cols []int
+	for i := range tab.columns {
+		c := &tab.columns[i]
+		if !strings.EqualFold(c.name, "ConcurrencyStamp") && c.text(u) != snapshot[i] {
+			cols = append(cols, i)
+		}
+	}
+	return cols
+}
+
+// columnNamesOf returns the names of the columns with the given indexes.
+func (tab *Table[T, P]) columnNamesOf(cols []int) []string {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = tab.columns[c].name
+	}
+	return names
+}
+
+func contains(a []int, v int) bool {
+	for _, x := range a {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -6,8 +6,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/forsyth/pwdatav3"
 	"github.com/go-sql-driver/mysql"
@@ -24,21 +27,76 @@ type Database struct {
 	// Param returns the string to be used for the n'th SQL command parameter.
 	Param func(n int) string
 
+	// Quote returns a single name (table or column) quoted as an SQL identifier,
+	// preserving its case. Qualified names such as dbo.AspNetUsers are quoted a part at a time (see Ident).
+	// If Quote is nil, names are used as they are.
+	Quote func(name string) string
+
 	// BoolVar returns a location of the type used by the database to store a bool, iniitalised to false.
 	BoolVar func() any
 
 	// BoolVal returns the boolean value of a location returned by BoolVar.
 	BoolVal func(a any) bool
 
+	// TimeVal, if not nil, converts the value read for a time column (LockoutEnd, or an extra
+	// time.Time field's column) to a time, or nil for NULL.
+	// By default the driver must yield a time.Time or nil.
+	// Either way, the result is then converted to UTC.
+	// Like LockoutEnd, extra time columns are taken to hold UTC, as ASP.NET Core writes them,
+	// and a column type that carries no time zone (MySQL's datetime) is read as a UTC wall clock.
+	TimeVal func(a any) (*time.Time, error)
+
+	// TimeArg, if not nil, converts a time column's value (possibly nil, otherwise always in UTC)
+	// to the value to be written. By default the time is passed to the driver as-is.
+	TimeArg func(t *time.Time) any
+
 	// IsDuplicate returns true iff the given error diagnoses an attempt to add a duplicate key value.
 	IsDuplicate func(error) bool
+
+	// Returning, if not nil, changes an INSERT statement to return the value of the given (quoted) column,
+	// which the database generates. Otherwise the driver's LastInsertId provides it.
+	Returning func(insert string, column string) string
+
+	// ForUpdate is appended to a SELECT in a transaction to lock the rows it reads,
+	// if the database supports that; otherwise it is empty.
+	ForUpdate string
+
+	// LockHint, if not empty, follows the table name in such a SELECT instead,
+	// for a database such as SQL Server that locks rows by a table hint.
+	LockHint string
+
+	// Columns returns a query, and its arguments, that lists the name, data type and
+	// maximum length in characters (NULL if not applicable) of each column of the given table, for Open and Migrate.
+	Columns func(table string) (query string, args []any)
+
+	// Dialect names the SQL dialect, for the DDL generated by Migrate:
+	// "mysql", "postgres", "sqlserver" or "sqlite".
+	Dialect string
 }
 
-// MySQLDatabase implements a database adapter for MySQL.
+// MySQLDatabase implements a database adapter for MySQL and MariaDB.
+// It accepts booleans stored either as bit(1), as in older schemas, or as the tinyint(1)
+// generated by the Pomelo EF Core provider, and Id columns of any string type,
+// including Pomelo's char(36) ascii for Guid keys.
+// The DSN must include parseTime=true; LockoutEnd, and any other time column, is read and written as UTC whatever its loc.
 var MySQLDatabase = &Database{
-	Param:   func(int) string { return "?" },
-	BoolVar: func() any { return []uint8{0} },
-	BoolVal: func(a any) bool { return a.([]uint8)[0] != 0 },
+	Param:     func(int) string { return "?" },
+	Quote:     func(name string) string { return "`" + strings.ReplaceAll(name, "`", "``") + "`" },
+	BoolVar:   func() any { return []uint8{0} },
+	BoolVal:   mysqlBool,
+	TimeVal:   mysqlTime,
+	ForUpdate: "FOR UPDATE",
+	Columns: func(table string) (string, []any) {
+		return informationSchema(table, "DATABASE()", "?")
+	},
+	Dialect: "mysql",
+	TimeArg: func(t *time.Time) any {
+		if t == nil {
+			return nil
+		}
+		// as text, so the driver does not convert it to its own loc
+		return t.Format(mysqlDateTimeLayout)
+	},
 	IsDuplicate: func(err error) bool {
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
 			// 1062 "duplicate value entered to a unique column" (in INSERT or UPDATE)
@@ -48,30 +106,216 @@ var MySQLDatabase = &Database{
 	},
 }
 
-//
-// if pgErr, ok := err.(*pq.Error); ok {
-//	switch pgErr.Code.Name() {
-//	case "foreign_key_violation", "unique_violation":
-//		return true
-//	default:
-//		return false
-//	}
-//	return false
-// }
-// sqlserver uses @p1, @p2, ...
-
-// Users provides access to the single database table containing registered users,
-// usually called 'aspnetusers'.
-type Users struct {
-	db    *sql.DB
-	table string    // database table name
-	style *Database // database-specific conventions
+// mysqlBool returns the value of a bit(1) or tinyint(1) column.
+// The driver yields bit(1) as a single byte 0 or 1, but tinyint(1) as int64 in the binary protocol
+// (prepared statements) and as decimal text in the text protocol.
+func mysqlBool(a any) bool {
+	switch a := a.(type) {
+	case []uint8:
+		if len(a) == 1 && a[0] <= 1 {
+			return a[0] != 0 // bit(1)
+		}
+		n, err := strconv.ParseInt(string(a), 10, 64)
+		return err == nil && n != 0
+	case int64:
+		return a != 0
+	case bool:
+		return a
+	}
+	return false
+}
+
+// mysqlDateTimeLayout is the text form of MySQL's datetime(6).
+const mysqlDateTimeLayout = "2006-01-02 15:04:05.999999"
+
+// mysqlTime interprets a datetime value, which carries no time zone but is always UTC.
+// The driver parses it only if the DSN has parseTime=true, and then in the DSN's loc,
+// so only the wall clock time is used.
+func mysqlTime(a any) (*time.Time, error) {
+	switch a := a.(type) {
+	case nil:
+		return nil, nil
+	case time.Time:
+		t := time.Date(a.Year(), a.Month(), a.Day(), a.Hour(), a.Minute(), a.Second(), a.Nanosecond(), time.UTC)
+		return &t, nil
+	case []uint8, string:
+		return nil, errors.New("datetime read as text: MySQL DSN must include parseTime=true")
+	}
+	return nil, fmt.Errorf("unexpected time value of type %T", a)
+}
+
+// PostgresDatabase implements a database adapter for PostgreSQL, as used by EF Core's Npgsql provider,
+// with either the pgx (stdlib) or lib/pq driver.
+// Npgsql keeps the C# names, so the table (typically "AspNetUsers") and its columns are
+// mixed-case identifiers that must be quoted; it uses real booleans, and LockoutEnd is timestamptz.
+var PostgresDatabase = &Database{
+	Param:     func(n int) string { return "$" + strconv.Itoa(n) },
+	Quote:     func(name string) string { return `"` + strings.ReplaceAll(name, `"`, `""`) + `"` },
+	BoolVar:   func() any { return false },
+	BoolVal:   func(a any) bool { b, _ := a.(bool); return b },
+	ForUpdate: "FOR UPDATE",
+	Returning: func(insert string, column string) string { return insert + " RETURNING " + column },
+	Columns: func(table string) (string, []any) {
+		return informationSchema(table, "current_schema()", "$")
+	},
+	Dialect: "postgres",
+	IsDuplicate: func(err error) bool {
+		// both pgconn.PgError and pq.Error provide SQLState, avoiding a dependency on either driver
+		var pgErr interface{ SQLState() string }
+		if errors.As(err, &pgErr) {
+			// 23505 unique_violation
+			return pgErr.SQLState() == "23505"
+		}
+		return false
+	},
+}
+
+// SQLServerDatabase implements a database adapter for Microsoft SQL Server with the go-mssqldb driver.
+// Names are bracket-quoted, so a table given as "dbo.AspNetUsers" becomes [dbo].[AspNetUsers].
+// Booleans are bit, which the driver maps to bool, and LockoutEnd is datetimeoffset.
+var SQLServerDatabase = &Database{
+	Param:   func(n int) string { return "@p" + strconv.Itoa(n) },
+	Quote:   func(name string) string { return "[" + strings.ReplaceAll(name, "]", "]]") + "]" },
+	BoolVar: func() any { return false },
+	BoolVal: func(a any) bool { b, _ := a.(bool); return b },
+	Returning: func(insert string, column string) string {
+		return strings.Replace(insert, ") VALUES (", ") OUTPUT INSERTED."+column+" VALUES (", 1)
+	},
+	// under READ COMMITTED, a plain SELECT takes no lock that lasts until the UPDATE
+	LockHint: "WITH (UPDLOCK, ROWLOCK)",
+	Columns: func(table string) (string, []any) {
+		return informationSchema(table, "SCHEMA_NAME()", "@p")
+	},
+	Dialect: "sqlserver",
+	IsDuplicate: func(err error) bool {
+		// mssql.Error provides SQLErrorNumber
+		var msErr interface{ SQLErrorNumber() int32 }
+		if errors.As(err, &msErr) {
+			// 2601 duplicate key row in unique index; 2627 violation of unique or primary key constraint
+			n := msErr.SQLErrorNumber()
+			return n == 2601 || n == 2627
+		}
+		return false
+	},
+}
+
+// SQLiteDatabase implements a database adapter for SQLite as used by EF Core's Sqlite provider,
+// with the pure-Go modernc.org/sqlite driver.
+// Booleans are INTEGER, and LockoutEnd is TEXT holding the .NET DateTimeOffset form
+// "yyyy-MM-dd HH:mm:ss.FFFFFFFzzz", which is read and written here (always written with offset +00:00).
+var SQLiteDatabase = &Database{
+	Param:   func(int) string { return "?" },
+	Quote:   func(name string) string { return `"` + strings.ReplaceAll(name, `"`, `""`) + `"` },
+	BoolVar: func() any { return int64(0) },
+	BoolVal: func(a any) bool { n, _ := a.(int64); return n != 0 },
+	TimeVal: func(a any) (*time.Time, error) {
+		switch a := a.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			return parseDateTimeOffset(a)
+		case []byte:
+			return parseDateTimeOffset(string(a))
+		case time.Time:
+			return &a, nil
+		}
+		return nil, fmt.Errorf("unexpected time value of type %T", a)
+	},
+	TimeArg: func(t *time.Time) any {
+		if t == nil {
+			return nil
+		}
+		return t.Format(dateTimeOffsetLayout)
+	},
+	Columns: func(table string) (string, []any) {
+		return "SELECT name, type, NULL FROM pragma_table_info(?)", []any{table}
+	},
+	Dialect: "sqlite",
+	IsDuplicate: func(err error) bool {
+		// sqlite.Error provides Code, the extended result code
+		var liteErr interface{ Code() int }
+		if errors.As(err, &liteErr) {
+			// SQLITE_CONSTRAINT_PRIMARYKEY (1555) or SQLITE_CONSTRAINT_UNIQUE (2067)
+			n := liteErr.Code()
+			return n == 1555 || n == 2067
+		}
+		return false
+	},
+}
+
+// informationSchema returns a query of INFORMATION_SCHEMA.COLUMNS for Database.Columns.
+// The table name can be qualified by its schema; otherwise the given SQL function yields the default.
+// Parameters are written as "?", or as the given prefix followed by the parameter number.
+func informationSchema(table string, defaultSchema string, param string) (string, []any) {
+	p := func(n int) string {
+		if param == "?" {
+			return param
+		}
+		return param + strconv.Itoa(n)
+	}
+	query := "SELECT COLUMN_NAME, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH FROM INFORMATION_SCHEMA.COLUMNS WHERE "
+	schema, name, ok := strings.Cut(table, ".")
+	if !ok {
+		return query + "TABLE_SCHEMA = " + defaultSchema + " AND TABLE_NAME = " + p(1), []any{table}
+	}
+	return query + "TABLE_SCHEMA = " + p(1) + " AND TABLE_NAME = " + p(2), []any{schema, name}
+}
+
+// dateTimeOffsetLayout matches the text form of .NET's DateTimeOffset used by EF Core (yyyy-MM-dd HH:mm:ss.FFFFFFFzzz).
+const dateTimeOffsetLayout = "2006-01-02 15:04:05.9999999-07:00"
+
+func parseDateTimeOffset(s string) (*time.Time, error) {
+	t, err := time.Parse(dateTimeOffsetLayout, s)
+	if err != nil {
+		// DateTime, without an offset, in UTC
+		var err1 error
+		t, err1 = time.Parse("2006-01-02 15:04:05.9999999", s)
+		if err1 != nil {
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// Table provides access to the single database table containing registered users,
+// usually called 'aspnetusers', with each user represented by a value of type T:
+// User itself, or an application's own struct type that embeds User
+// and adds fields for the table's extra columns (see NewTable).
+type Table[T any, P UserType[T]] struct {
+	db      *sql.DB
+	table   string    // database table name
+	style   *Database // database-specific conventions
+	columns []column  // columns other than Id, in order
+	legacy  bool      // Identity 2 schema: no Normalized columns or ConcurrencyStamp
+	id      string    // the table's spelling of the Id column
+	key     *Key      // representation of Id
+	schema  Schema    // Identity schema version, determining the features available
+	noTrack bool      // TrackFailures is false
+
+	relatedMu sync.Mutex
+	related   []userTable // tables with rows belonging to a user, removed by Delete
+	relatedOK bool        // related has been found
 
 	// SQL statements needed
-	queryID   string
-	queryName string
-	insert    string
-	update    string
+	queryID    string
+	queryName  string
+	queryEmail string
+	queryAll   string
+	insert     string // Id generated by the database
+	insertID   string
+	update     string
+	remove     string
+	queryLock  string // queryID, locking the row in a transaction
+}
+
+// Users provides access to a table containing just the columns ASP.NET Identity itself defines.
+type Users = Table[User, *User]
+
+// UserType constrains the type of user values in a Table: a pointer to User,
+// or to a struct type that embeds User.
+type UserType[T any] interface {
+	*T
+	IdentityUser() *User
 }
 
 // User represents a single entry in the ASP.NET-compatible database.
@@ -80,7 +324,7 @@ type Users struct {
 // in some schemas, with a different date type. The Normalized fields did not exist in
 // some older versions of ASP.NET.
 type User struct {
-	ID                   string     // the primary key for this user (UUID form)
+	ID                   string     // the primary key for this user (UUID form, unless the table has another Key)
 	UserName             string     // the user name
 	NormalizedUserName   string     // normalised user name
 	Email                string     // email address
@@ -97,6 +341,12 @@ type User struct {
 	AccessFailedCount    int        // failed login attempts, up to system limit for lockout
 }
 
+// IdentityUser returns u itself. Through embedding, it gives access to the User
+// within an application's own user type.
+func (u *User) IdentityUser() *User {
+	return u
+}
+
 var (
 	// ErrNoPassword is returned if any call has an empty or completely blank password field.
 	ErrNoPassword = errors.New("missing password")
@@ -111,89 +361,164 @@ var (
 	// record had been changed or deleted underfoot. Refetch the value to see what changed.
 	ErrConcurrency = errors.New("clashing concurrent update")
 
+	// ErrAmbiguous is returned by FindByEmail if more than one user has the email address.
+	ErrAmbiguous = errors.New("email address registered to more than one user")
+
 	// ErrInvalidCredentials is returned if an authentication attempt failed,
 	// owing to a non-existent user name or bad password.
 	ErrInvalidCredentials = errors.New("invalid user name or password")
 
 	// ErrLockedOut is returned by the optional check for a locked-out account.
 	ErrLockedOut = errors.New("user account locked out")
+
+	// ErrUnsupported is returned by an operation that the table's Identity schema version does not support.
+	ErrUnsupported = errors.New("not supported by the Identity schema version")
+
+	// ErrNotNormalized is returned by Update if NormalizedUserName or NormalizedEmail is not the normalised form
+	// of UserName or Email, which would make the user impossible to find; see SetUserName and SetEmail.
+	ErrNotNormalized = errors.New("user name or email address not normalised")
+
+	// ErrTooLong is returned by Update if PhoneNumber is longer than the schema allows
+	// (256 characters from SchemaVersion2).
+	ErrTooLong = errors.New("phone number too long")
 )
 
 var emptyHash = mustHashPassword("")
 
-// NewUsers gives this package access to the ASP.NET users table (usually "aspnetusers")
+// New gives this package access to the ASP.NET users table (usually "aspnetusers")
 // in the given database. SQL database implementations disagree on some essentials. The Database style
 // parameter gives little functions to provide all that is needed here.
-// It defaults to MySQLDatabase.
+// It defaults to MySQLDatabase; PostgresDatabase, SQLServerDatabase and SQLiteDatabase are the alternatives.
+// New assumes the table has the current ASP.NET Core schema; see Open to check that first.
 func New(db *sql.DB, table string, style *Database) *Users {
+	tab, err := NewTable[User](db, table, style)
+	if err != nil {
+		// User has no extra columns to go wrong
+		panic("aspnetusers: " + err.Error())
+	}
+	return tab
+}
+
+// NewTable is like New, but represents users by values of type T, which embeds User.
+// T's other fields that are tagged `aspnet:"Column"` correspond to extra columns in the table
+// (typically added by a derived ApplicationUser class in C#),
+// and are read and written along with the standard ones.
+// Tagged fields can have types string, bool, int, int32, int64 (or types defined from them, such as type Tenant string),
+// time.Time, *time.Time, or any type that implements both sql.Scanner and driver.Valuer, such as sql.NullString.
+// Time fields are read and written in UTC, as LockoutEnd is (see Database.TimeVal).
+// NewTable returns an error if T's tags cannot be used.
+func NewTable[T any, P UserType[T]](db *sql.DB, table string, style *Database) (*Table[T, P], error) {
 	if style == nil {
 		style = MySQLDatabase
 	}
-	// TO DO: generate the statements
-	return &Users{db: db, table: table, style: style}
-}
-
-// columns in lexical order excluding Id.
-// As noted above, in ASP.NET the LockoutEnd field had several different names and types historically;
-// LockoutEnd was that in use when this package was made.
-var cols = []string{
-	"AccessFailedCount", "ConcurrencyStamp", "Email", "EmailConfirmed", "LockoutEnabled", "LockoutEnd",
-	"NormalizedEmail", "NormalizedUserName", "PasswordHash", "PhoneNumber",
-	"PhoneNumberConfirmed", "SecurityStamp", "TwoFactorEnabled", "UserName",
-}
-
-func (tab *Users) unpackUser(row *sql.Row) (*User, error) {
-	u := &User{}
-	var concurrencyStamp, email, normalizedEmail, normalizedUserName sql.NullString
-	var passwordHash, phoneNumber, securityStamp, userName sql.NullString
-	var lockoutEnd sql.NullTime
-	// MySQL lacks boolean type, uses numeric bit(1) or tinyint(1): must use an intermediate value
-	// arguably the driver should be brighter, given there is sql.Bool
-	emailConfirmed := tab.style.BoolVar()
-	lockoutEnabled := tab.style.BoolVar()
-	phoneNumberConfirmed := tab.style.BoolVar()
-	twoFactorEnabled := tab.style.BoolVar()
-	err := row.Scan(&u.ID,
-		&u.AccessFailedCount,
-		&concurrencyStamp,
-		&email,
-		&emailConfirmed,
-		&lockoutEnabled,
-		&lockoutEnd,
-		&normalizedEmail,
-		&normalizedUserName,
-		&passwordHash,
-		&phoneNumber,
-		&phoneNumberConfirmed,
-		&securityStamp,
-		&twoFactorEnabled,
-		&userName)
+	extras, err := extraColumns[T]()
+	if err != nil {
+		return nil, err
+	}
+	tab := &Table[T, P]{db: db, table: table, style: style, columns: append(defaultColumns(), extras...), id: "Id", key: StringKey,
+		schema: Schema{Version: SchemaVersion1, Provider: efProvider(style, nil)}}
+	tab.prepare()
+	return tab, nil
+}
+
+// prepare generates the SQL statements for the table's columns.
+func (tab *Table[T, P]) prepare() {
+	db := tab.style
+	names := tab.columnNames()
+	n := len(names)
+	tab.queryID = db.cmd("SELECT", ident(tab.col("Id")), ",", names, "FROM", ident(tab.table), "WHERE", ident(tab.col("Id")), "=", db.Param(1))
+	tab.queryName = db.cmd("SELECT", ident(tab.col("Id")), ",", names, "FROM", ident(tab.table), "WHERE", ident(tab.col("NormalizedUserName")), "=", db.Param(1))
+	tab.queryEmail = db.cmd("SELECT", ident(tab.col("Id")), ",", names, "FROM", ident(tab.table), "WHERE", ident(tab.col("NormalizedEmail")), "=", db.Param(1), "ORDER BY", ident(tab.col("Id")))
+	tab.queryAll = db.cmd("SELECT", ident(tab.col("Id")), ",", names, "FROM", ident(tab.table), "ORDER BY", ident(tab.col("Id")))
+	tab.insertID = db.cmd("INSERT INTO", ident(tab.table), "(", ident(tab.col("Id")), ",", names, ") VALUES (", db.params(1+n), ")")
+	tab.insert = db.cmd("INSERT INTO", ident(tab.table), "(", names, ") VALUES (", db.params(n), ")")
+	if db.Returning != nil {
+		tab.insert = db.Returning(tab.insert, db.Ident(tab.col("Id")))
+	}
+	tab.update = db.cmd("UPDATE", ident(tab.table), "SET", db.assign(names),
+		"WHERE", ident(tab.col("Id")), "=", db.Param(n+1), "AND", tab.stampIs("ConcurrencyStamp", n+2))
+	tab.remove = db.cmd("DELETE FROM", ident(tab.table), "WHERE", ident(tab.col("Id")), "=", db.Param(1), "AND", tab.stampIs("ConcurrencyStamp", 2))
+	tab.queryLock = db.cmd("SELECT", ident(tab.col("Id")), ",", names, "FROM", ident(tab.table), db.LockHint, "WHERE", ident(tab.col("Id")), "=", db.Param(1), db.ForUpdate)
+	if tab.legacy {
+		// UserName has a case-insensitive collation, and a unique index
+		tab.queryName = db.cmd("SELECT", ident(tab.col("Id")), ",", names, "FROM", ident(tab.table), "WHERE", ident(tab.col("UserName")), "=", db.Param(1))
+		tab.queryEmail = db.cmd("SELECT", ident(tab.col("Id")), ",", names, "FROM", ident(tab.table), "WHERE", ident(tab.col("Email")), "=", db.Param(1), "ORDER BY", ident(tab.col("Id")))
+		tab.update = db.cmd("UPDATE", ident(tab.table), "SET", db.assign(names),
+			"WHERE", ident(tab.col("Id")), "=", db.Param(n+1), "AND", tab.stampIs("SecurityStamp", n+2))
+		tab.remove = db.cmd("DELETE FROM", ident(tab.table), "WHERE", ident(tab.col("Id")), "=", db.Param(1), "AND", tab.stampIs("SecurityStamp", 2))
+	}
+}
+
+// stampIs returns the condition that the named stamp column has the value of the n'th parameter.
+// A NULL stamp, which is read as an empty string, matches an empty one, as in MemoryStore.
+func (tab *Table[T, P]) stampIs(name string, n int) string {
+	return "COALESCE(" + tab.style.Ident(tab.col(name)) + ", '') = " + tab.style.Param(n)
+}
+
+// col returns the table's own spelling of the named standard column, as found by Open,
+// which matters for a database such as PostgreSQL whose quoted names are case-sensitive.
+func (tab *Table[T, P]) col(name string) string {
+	if name == "Id" {
+		return tab.id
+	}
+	for i := range tab.columns {
+		if strings.EqualFold(tab.columns[i].name, name) {
+			return tab.columns[i].name
+		}
+	}
+	return name
+}
+
+// values returns u's values for the columns other than Id, as written to the database.
+func (tab *Table[T, P]) values(u P) []any {
+	vals := make([]any, len(tab.columns))
+	for i := range tab.columns {
+		vals[i] = tab.columns[i].value(tab.style, u)
+	}
+	return vals
+}
+
+// unpackUser reads a user from a row of the result of one of the table's queries.
+func (tab *Table[T, P]) unpackUser(row interface{ Scan(...any) error }) (P, error) {
+	u := P(new(T))
+	iu := u.IdentityUser()
+	var id any
+	vars := make([]any, 1+len(tab.columns))
+	vars[0] = &id
+	for i := range tab.columns {
+		vars[1+i] = tab.columns[i].scanVar(tab.style, u)
+	}
+	err := row.Scan(vars...)
 	if err != nil {
 		return nil, err
 	}
-	u.ConcurrencyStamp = opts(&concurrencyStamp)
-	u.Email = opts(&email)
-	u.EmailConfirmed = tab.style.BoolVal(emailConfirmed)
-	u.NormalizedEmail = opts(&normalizedEmail)
-	u.NormalizedUserName = opts(&normalizedUserName)
-	u.PasswordHash = opts(&passwordHash)
-	u.PhoneNumber = opts(&phoneNumber)
-	u.PhoneNumberConfirmed = tab.style.BoolVal(phoneNumberConfirmed)
-	u.SecurityStamp = opts(&securityStamp)
-	u.TwoFactorEnabled = tab.style.BoolVal(twoFactorEnabled)
-	u.UserName = opts(&userName)
-	u.LockoutEnabled = tab.style.BoolVal(lockoutEnabled)
-	if lockoutEnd.Valid {
-		u.LockoutEnd = &lockoutEnd.Time
+	iu.ID, err = tab.key.Val(id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tab.columns {
+		err = tab.columns[i].set(tab.style, u, vars[1+i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if tab.legacy {
+		iu.NormalizedUserName = Normalize(iu.UserName)
+		iu.NormalizedEmail = Normalize(iu.Email)
+		iu.ConcurrencyStamp = tab.rowStamp(u)
 	}
 	return u, nil
 }
 
 // FindByID given a user's ID returns the database entry for a registered user, or an error.
 // If the user does not exist, the error is exactly ErrNotFound.
-func (tab *Users) FindByID(uid string) (*User, error) {
-	stmt := tab.style.cmd("SELECT id,", cols, "FROM", tab.table, "WHERE Id = ", tab.style.Param(1))
-	u, err := tab.unpackUser(tab.db.QueryRow(stmt, uid))
+func (tab *Table[T, P]) FindByID(uid string) (P, error) {
+	id, err := tab.key.Arg(uid)
+	if err != nil {
+		// no user can have it
+		return nil, ErrNotFound
+	}
+	u, err := tab.unpackUser(tab.db.QueryRow(tab.queryID, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNotFound
@@ -203,12 +528,37 @@ func (tab *Users) FindByID(uid string) (*User, error) {
 	return u, nil
 }
 
+// Each calls fn for each user in the table, in order of ID, stopping at the first error,
+// which it returns.
+func (tab *Table[T, P]) Each(fn func(u P) error) error {
+	rows, err := tab.db.Query(tab.queryAll)
+	if err != nil {
+		return fmt.Errorf("list users: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		u, err := tab.unpackUser(rows)
+		if err != nil {
+			return fmt.Errorf("list users: %v", err)
+		}
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("list users: %v", err)
+	}
+	return nil
+}
+
 // FindByName given a unique user name (typically now an email address) returns the database entry for a registered user, or an error.
 // If the user does not exist, the error is exactly ErrNotFound.
-func (tab *Users) FindByName(username string) (*User, error) {
-	stmt := tab.style.cmd("SELECT id,", cols, "FROM", tab.table, "WHERE NormalizedUserName = ", tab.style.Param(1))
-	key := normalise(username)
-	u, err := tab.unpackUser(tab.db.QueryRow(stmt, key))
+func (tab *Table[T, P]) FindByName(username string) (P, error) {
+	key := Normalize(username)
+	if tab.legacy {
+		key = username
+	}
+	u, err := tab.unpackUser(tab.db.QueryRow(tab.queryName, key))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNotFound
@@ -218,6 +568,38 @@ func (tab *Users) FindByName(username string) (*User, error) {
 	return u, nil
 }
 
+// UsersByEmail returns the users with the given email address, compared in normalised form, in order of ID.
+// Unlike user names, email addresses need not be unique; see FindByEmail.
+func (tab *Table[T, P]) UsersByEmail(email string) ([]P, error) {
+	key := Normalize(email)
+	if tab.legacy {
+		key = email
+	}
+	rows, err := tab.db.Query(tab.queryEmail, key)
+	if err != nil {
+		return nil, fmt.Errorf("find users by email: %v", err)
+	}
+	defer rows.Close()
+	var users []P
+	for rows.Next() {
+		u, err := tab.unpackUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("find users by email: %v", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("find users by email: %v", err)
+	}
+	return users, nil
+}
+
+// FindByEmail returns the one user with the given email address, compared in normalised form.
+// If there is none, the error is exactly ErrNotFound; if there are several, exactly ErrAmbiguous.
+func (tab *Table[T, P]) FindByEmail(email string) (P, error) {
+	return FindByEmail[P](tab, email)
+}
+
 func opts(opt *sql.NullString) string {
 	if opt.Valid {
 		return opt.String
@@ -227,76 +609,87 @@ func opts(opt *sql.NullString) string {
 
 // NewUser makes a new user entry in the ASP.NET identity database, returning error ErrExists if the name's already there.
 // The NormalizedUserName column is a unique key, so the INSERT will fail if there's a duplicate, avoiding locks or transactions.
-func (tab *Users) NewUser(name, email, password string) (*User, error) {
-	u, err := tab.FindByName(name)
-	if err != nil && err != ErrNotFound {
-		return nil, err
-	}
-	if u != nil {
-		//		return nil, ErrExists
-	}
-	if emptyPassword(password) {
-		return nil, ErrNoPassword
-	}
-	pwd, err := pwdatav3.GenerateFromPassword([]byte(password), pwdatav3.DefaultIter)
-	if err != nil {
-		return nil, fmt.Errorf("hashing password: %v", err)
-	}
-	u = &User{
-		ID:                 newStamp(),
-		UserName:           name,
-		NormalizedUserName: normalise(name),
-		PasswordHash:       pwdatav3.EncodeToString(pwd),
-		Email:              email,
-		NormalizedEmail:    normalise(email),
-		SecurityStamp:      newStamp(),
-		ConcurrencyStamp:   newStamp(),
-	}
-	stmt := tab.style.cmd("INSERT INTO", tab.table, "(Id, ", cols, ") VALUES (", tab.style.params(1+len(cols)), ")")
-	_, err = tab.db.Exec(stmt, u.ID, u.AccessFailedCount, u.ConcurrencyStamp, u.Email, u.EmailConfirmed, u.LockoutEnabled, u.LockoutEnd,
-		u.NormalizedEmail, u.NormalizedUserName, u.PasswordHash, u.PhoneNumber, u.PhoneNumberConfirmed, u.SecurityStamp,
-		u.TwoFactorEnabled, u.UserName)
+// Any extra columns have T's zero values; set them with Update.
+func (tab *Table[T, P]) NewUser(name, email, password string) (P, error) {
+	return NewUser[T](tab, name, email, password)
+}
+
+// Create adds a new user to the table, returning exactly ErrExists if the NormalizedUserName is already registered.
+// If u.ID is empty, the table's Key generates it, or the database does; otherwise it is kept.
+// NewUser is usually more convenient.
+func (tab *Table[T, P]) Create(u P) error {
+	err := tab.insertUser(u)
 	if err != nil {
 		if tab.style.IsDuplicate(err) {
-			return nil, ErrExists
+			return ErrExists
 		}
-		return nil, fmt.Errorf("adding new user: %v", err)
+		return fmt.Errorf("adding new user: %v", err)
 	}
-	return u, nil
+	if tab.legacy {
+		u.IdentityUser().ConcurrencyStamp = tab.rowStamp(u)
+	}
+	return nil
 }
 
-// Authenticate, given a user name (email) and password, returns either a user identity or an error.
-// If either the authentication fails or the user does not exist, it returns exactly the error ErrInvalidCredentials.
-// The AccessFailedCount counts successive authentication failures, but is reset on the next success.
-func (tab *Users) Authenticate(name, password string) (*User, error) {
-	u, err := tab.FindByName(name)
-	if err != nil && err != ErrNotFound {
-		return u, err
+// insertUser adds u to the table, setting u's ID if it is empty.
+func (tab *Table[T, P]) insertUser(u P) error {
+	iu := u.IdentityUser()
+	if iu.ID == "" && tab.key.Generate != nil {
+		iu.ID = tab.key.Generate()
 	}
-	if u == nil {
-		// set to a dummy value to avoid over-quick return
-		u = &User{PasswordHash: emptyHash}
-	}
-	pwd, err := pwdatav3.DecodeString(u.PasswordHash)
-	if err != nil {
-		return nil, err
+	if iu.ID != "" {
+		id, err := tab.key.Arg(iu.ID)
+		if err != nil {
+			return err
+		}
+		_, err = tab.db.Exec(tab.insertID, append([]any{id}, tab.values(u)...)...)
+		return err
 	}
-	ok := pwdatav3.CompareHashAndPassword(pwd, []byte(password)) == nil
-	tab.accessFailed(u, !ok)
-	if !ok {
-		return nil, ErrInvalidCredentials
+	var id any
+	if tab.style.Returning != nil {
+		err := tab.db.QueryRow(tab.insert, tab.values(u)...).Scan(&id)
+		if err != nil {
+			return err
+		}
+	} else {
+		res, err := tab.db.Exec(tab.insert, tab.values(u)...)
+		if err != nil {
+			return err
+		}
+		id, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
 	}
-	return u, nil
+	var err error
+	iu.ID, err = tab.key.Val(id)
+	return err
 }
 
-// accessFailed tracks authentication failures but if there's a success, the count is reset.
-func (tab *Users) accessFailed(u *User, bad bool) error {
-	if bad {
-		u.AccessFailedCount++
-	} else {
-		u.AccessFailedCount = 0
-	}
-	return tab.Update(u)
+// Authenticate, given a user name (email) and password, returns either a user identity or an error.
+// If either the authentication fails or the user does not exist, it returns exactly the error ErrInvalidCredentials.
+// The AccessFailedCount counts successive authentication failures, but is reset on the next success,
+// unless SetTrackFailures has turned that off.
+func (tab *Table[T, P]) Authenticate(name, password string) (P, error) {
+	return Authenticate[T](tab, name, password)
+}
+
+// TrackFailures reports whether Authenticate and SignIn count failures in AccessFailedCount,
+// as they do unless SetTrackFailures(false) was called. It makes Table a FailureTracking store.
+func (tab *Table[T, P]) TrackFailures() bool {
+	return !tab.noTrack
+}
+
+// SetTrackFailures sets whether Authenticate and SignIn count failures in AccessFailedCount.
+// With tracking off, they never write to the table, so they can authenticate users from a read-only replica.
+// It should be set before the Table is shared.
+func (tab *Table[T, P]) SetTrackFailures(on bool) {
+	tab.noTrack = !on
+}
+
+// SignIn is like Authenticate, but accepts either the user name or the email address of a user.
+func (tab *Table[T, P]) SignIn(login, password string) (P, error) {
+	return SignIn[T](tab, login, password)
 }
 
 func newStamp() string {
@@ -310,70 +703,58 @@ func emptyPassword(s string) bool {
 // ChangePassword tries to update the User's password, rejecting empty ones,
 // and if successful, updates both the value and the database.
 // Both are left unchanged on failure.
-func (tab *Users) ChangePassword(u *User, password string) error {
-	if emptyPassword(password) {
-		return ErrNoPassword
-	}
-	pwd, err := pwdatav3.New(password, pwdatav3.DefaultIter)
-	if err != nil {
-		// it can only be rand.Read failing
-		return fmt.Errorf("change password: %v", err)
-	}
-	text, err := pwd.MarshalText()
-	if err != nil {
-		// can't happen, but j.i.c.
-		return fmt.Errorf("change password: %v", err)
-	}
-	nu := new(User)
-	*nu = *u
-	nu.PasswordHash = string(text)
-	nu.SecurityStamp = newStamp()
-	err = tab.Update(nu)
-	if err != nil {
-		return err
-	}
-	u.PasswordHash = nu.PasswordHash
-	u.SecurityStamp = nu.SecurityStamp
-	return nil
+func (tab *Table[T, P]) ChangePassword(u P, password string) error {
+	return ChangePassword[T](tab, u, password)
+}
+
+// UpdateFunc fetches the user with the given ID, applies mutate, and updates the table,
+// retrying if another process changed the user meanwhile, as the package function UpdateFunc does.
+func (tab *Table[T, P]) UpdateFunc(id string, mutate func(u P) error) (P, error) {
+	return UpdateFunc[T](tab, id, mutate)
 }
 
 // ConfirmEmail marks the user as having confirmed the email address,
 // and updates the database entry (which might yield an error).
-func (tab *Users) ConfirmEmail(u *User) error {
-	u.EmailConfirmed = true
-	return tab.Update(u)
+func (tab *Table[T, P]) ConfirmEmail(u P) error {
+	return ConfirmEmail[T](tab, u)
 }
 
 // Update replaces the existing database values for a given user,
 // based on the unique ID. The ConcurrencyStamp value guards
-// against a concurrent update or removal of the database record.
+// against a concurrent update or removal of the database record;
+// a NULL ConcurrencyStamp, which is read as an empty string, matches an empty one.
 // If the check fails, Update returns exactly the error ErrConcurrency,
 // and the caller should refetch the value to get the current settings.
 // Otherwise, if the operation succeeded, the User value's
 // ConcurrencyStamp is updated for use in the next update.
-func (tab *Users) Update(u *User) error {
-	stamp := newStamp()
-	stmt := tab.style.cmd("UPDATE", tab.table, "SET", tab.style.assign(cols), "WHERE Id =", tab.style.Param(len(cols)+1), "AND ConcurrencyStamp =", tab.style.Param(len(cols)+2))
-	res, err := tab.db.Exec(stmt,
-		u.AccessFailedCount,
-		stamp,
-		u.Email,
-		u.EmailConfirmed,
-		u.LockoutEnabled,
-		u.LockoutEnd,
-		u.NormalizedEmail,
-		u.NormalizedUserName,
-		u.PasswordHash,
-		u.PhoneNumber,
-		u.PhoneNumberConfirmed,
-		u.SecurityStamp,
-		u.TwoFactorEnabled,
-		u.UserName,
-		u.ID,
-		u.ConcurrencyStamp)
+// If NormalizedUserName has changed to one already registered, Update returns exactly ErrExists.
+// Update returns exactly ErrNotNormalized if the Normalized fields do not match UserName and Email (see CheckNormalized).
+// From SchemaVersion2, Update refuses a PhoneNumber longer than 256 characters with ErrTooLong.
+func (tab *Table[T, P]) Update(u P) error {
+	if err := CheckNormalized(u.IdentityUser()); err != nil {
+		return err
+	}
+	if tab.schema.Version >= SchemaVersion2 && utf8.RuneCountInString(u.IdentityUser().PhoneNumber) > 256 {
+		return ErrTooLong
+	}
+	if tab.legacy {
+		return tab.updateLegacy(u)
+	}
+	nu := P(new(T))
+	*nu = *u
+	nu.IdentityUser().ConcurrencyStamp = newStamp()
+	iu := u.IdentityUser()
+	id, err := tab.key.Arg(iu.ID)
 	if err != nil {
 		return err
 	}
+	res, err := tab.db.Exec(tab.update, append(tab.values(nu), id, iu.ConcurrencyStamp)...)
+	if err != nil {
+		if tab.style.IsDuplicate(err) {
+			return ErrExists
+		}
+		return err
+	}
 	nr, err := res.RowsAffected()
 	if err != nil {
 		return err
@@ -382,39 +763,38 @@ func (tab *Users) Update(u *User) error {
 		// lost race: was updated (hence new concurrency stamp) or deleted by another process
 		return ErrConcurrency
 	}
-	u.ConcurrencyStamp = stamp
+	iu.ConcurrencyStamp = nu.IdentityUser().ConcurrencyStamp
 	return nil
 }
 
+// SetUserName changes the user's name, as the package function SetUserName does.
+func (tab *Table[T, P]) SetUserName(u P, name string) error {
+	return SetUserName[T](tab, u, name)
+}
+
+// SetEmail changes the user's email address, as the package function SetEmail does.
+func (tab *Table[T, P]) SetEmail(u P, email string) error {
+	return SetEmail[T](tab, u, email)
+}
+
+// SetPhoneNumber changes the user's phone number, as the package function SetPhoneNumber does.
+func (tab *Table[T, P]) SetPhoneNumber(u P, phone string) error {
+	return SetPhoneNumber[T](tab, u, phone)
+}
+
 // CheckLockout returns an error iff the given user remains locked out from authentication.
-func (tab *Users) CheckLockout(u *User) error {
-	if u.LockoutEnabled && u.LockoutEnd != nil && time.Now().Before(*u.LockoutEnd) {
-		return ErrLockedOut
-	}
-	return nil
+func (tab *Table[T, P]) CheckLockout(u P) error {
+	return CheckLockout(u.IdentityUser())
 }
 
 // ResetLockout resets the lockout mark and timeout for a given user.
-func (tab *Users) ResetLockout(u *User) error {
-	if u.LockoutEnd != nil {
-		u.LockoutEnd = nil
-		return tab.Update(u)
-	}
-	return nil
+func (tab *Table[T, P]) ResetLockout(u P) error {
+	return ResetLockout[T](tab, u)
 }
 
 // LockOut locks out the user for the given duration.
-func (tab *Users) LockOut(u *User, d time.Duration) error {
-	nu := new(User)
-	*nu = *u
-	end := time.Now().Add(d)
-	nu.LockoutEnd = &end
-	err := tab.Update(nu)
-	if err != nil {
-		return err
-	}
-	u.LockoutEnd = &end
-	return nil
+func (tab *Table[T, P]) LockOut(u P, d time.Duration) error {
+	return LockOut[T](tab, u, d)
 }
 
 func mustHashPassword(pw string) string {
@@ -425,6 +805,43 @@ func mustHashPassword(pw string) string {
 	return pwdatav3.EncodeToString(pwd)
 }
 
+// timeVal converts a time column's value read from the database to a time in UTC, or nil.
+func (db *Database) timeVal(a any) (*time.Time, error) {
+	var t *time.Time
+	if db.TimeVal != nil {
+		var err error
+		t, err = db.TimeVal(a)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		switch a := a.(type) {
+		case nil:
+		case time.Time:
+			t = &a
+		default:
+			return nil, fmt.Errorf("unexpected time value of type %T", a)
+		}
+	}
+	if t == nil {
+		return nil, nil
+	}
+	utc := t.UTC()
+	return &utc, nil
+}
+
+// timeArg converts a time column's value to UTC and then to the form the database stores.
+func (db *Database) timeArg(t *time.Time) any {
+	if t != nil {
+		utc := t.UTC()
+		t = &utc
+	}
+	if db.TimeArg != nil {
+		return db.TimeArg(t)
+	}
+	return t
+}
+
 func (db *Database) params(n int) string {
 	var sb strings.Builder
 	for i := 0; i < n; i++ {
@@ -442,13 +859,31 @@ func (db *Database) assign(cols []string) string {
 		if i > 0 {
 			sb.WriteString(", ")
 		}
-		sb.WriteString(n)
+		sb.WriteString(db.Ident(n))
 		sb.WriteString("=")
 		sb.WriteString(db.Param(i + 1))
 	}
 	return sb.String()
 }
 
+// ident is a table or column name, to be quoted by cmd.
+type ident string
+
+// Ident quotes a possibly-qualified name, such as dbo.AspNetUsers, using the database's conventions,
+// as the Table's own statements do. It returns the name as it is if Quote is nil.
+func (db *Database) Ident(name string) string {
+	if db.Quote == nil {
+		return name
+	}
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = db.Quote(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// cmd assembles an SQL command from its verb and arguments, separated by spaces.
+// Strings are copied as-is; idents and the elements of a []string (column names) are quoted.
 func (db *Database) cmd(verb string, args ...any) string {
 	var sb strings.Builder
 	sb.WriteString(verb)
@@ -457,12 +892,14 @@ func (db *Database) cmd(verb string, args ...any) string {
 		switch a := a.(type) {
 		case string:
 			sb.WriteString(a)
+		case ident:
+			sb.WriteString(db.Ident(string(a)))
 		case []string:
 			for j, s := range a {
 				if j != 0 {
 					sb.WriteString(", ")
 				}
-				sb.WriteString(s)
+				sb.WriteString(db.Ident(s))
 			}
 		default:
 			sb.WriteString(fmt.Sprint(a))
@@ -471,6 +908,9 @@ func (db *Database) cmd(verb string, args ...any) string {
 	return sb.String()
 }
 
-func normalise(s string) string {
+// Normalize returns the normalised form of a user name or email address, as held in
+// NormalizedUserName and NormalizedEmail, and used to look them up
+// (as by ASP.NET's UpperInvariantLookupNormalizer).
+func Normalize(s string) string {
 	return strings.ToUpper(s)
 }
@@ -3,10 +3,20 @@ package aspnetusers
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/forsyth/aspnetusers/internal/testdb"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/microsoft/go-mssqldb"
+	_ "modernc.org/sqlite"
 )
 
 var names = []string{"frodo@sauron.com", "jake@example.com", "joseph@example.com", "jenny@example.com"}
@@ -33,91 +43,1598 @@ var testusers = []testuser{
 	},
 }
 
+// TestUser runs against the MySQL database named by USERS_DSN (which must allow multiStatements),
+// or by default against a local in-memory MySQL-compatible server (see package internal/testdb).
 func TestUser(t *testing.T) {
 	dsn := os.Getenv("USERS_DSN")
 	if dsn == "" {
-		t.Fatalf("must set USERS_DSN to the dsn value for the test database")
+		dsn = testdb.MySQL(t)
 	}
-	db, err := openDB(dsn)
+	db, err := openDB("mysql", dsn)
 	if err != nil {
 		t.Fatalf("cannot open db: %v", err)
 	}
-	err = initDB(db)
+	err = initDB(db, "./testdata")
 	if err != nil {
 		t.Fatal(err)
 	}
 	tab := New(db, "aspnetusers", nil)
 	t.Run("IdentiyUser", func(t *testing.T) {
-		for _, n := range names {
-			u, err := tab.FindByName(n)
+		testIdentityUser(t, tab)
+	})
+
+	// the same again with the Pomelo provider's tinyint(1) booleans and char(36) keys
+	err = initDB(db, "./testdata/pomelo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab = New(db, "AspNetUsers", MySQLDatabase)
+	t.Run("Pomelo", func(t *testing.T) {
+		testIdentityUser(t, tab)
+	})
+}
+
+func TestMySQLBool(t *testing.T) {
+	tests := []struct {
+		v    any
+		want bool
+	}{
+		{[]uint8{0}, false}, // bit(1)
+		{[]uint8{1}, true},
+		{[]uint8("0"), false}, // tinyint(1), text protocol
+		{[]uint8("1"), true},
+		{[]uint8("-1"), true},
+		{int64(0), false}, // tinyint(1), binary protocol
+		{int64(1), true},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := MySQLDatabase.BoolVal(tt.v); got != tt.want {
+			t.Errorf("BoolVal(%#v): want %v, got %v", tt.v, tt.want, got)
+		}
+	}
+}
+
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("USERS_PG_DSN")
+	if dsn == "" {
+		t.Skip("set USERS_PG_DSN to the dsn value for a PostgreSQL test database")
+	}
+	db, err := openDB("pgx", dsn)
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	err = initDB(db, "./testdata/postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab := New(db, "AspNetUsers", PostgresDatabase)
+	t.Run("IdentityUser", func(t *testing.T) {
+		testIdentityUser(t, tab)
+	})
+}
+
+func TestSQLServer(t *testing.T) {
+	dsn := os.Getenv("USERS_MSSQL_DSN")
+	if dsn == "" {
+		t.Skip("set USERS_MSSQL_DSN to the dsn value for a SQL Server test database")
+	}
+	db, err := openDB("sqlserver", dsn)
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	err = initDB(db, "./testdata/sqlserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab := New(db, "dbo.AspNetUsers", SQLServerDatabase)
+	t.Run("IdentityUser", func(t *testing.T) {
+		testIdentityUser(t, tab)
+	})
+}
+
+func TestSQLite(t *testing.T) {
+	db, err := openDB("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+	err = initDB(db, "./testdata/sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab := New(db, "AspNetUsers", SQLiteDatabase)
+	t.Run("IdentityUser", func(t *testing.T) {
+		testIdentityUser(t, tab)
+	})
+	t.Run("LockoutEnd", func(t *testing.T) {
+		u, err := tab.FindByName(names[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tab.LockOut(u, time.Hour)
+		if err != nil {
+			t.Fatalf("%s: lock out: %v", u.UserName, err)
+		}
+		var text string
+		err = db.QueryRow(`SELECT "LockoutEnd" FROM "AspNetUsers" WHERE "Id" = ?`, u.ID).Scan(&text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := u.LockoutEnd.Format("2006-01-02 15:04:05.9999999-07:00"); text != want {
+			t.Errorf("%s: LockoutEnd stored as %q, want %q", u.UserName, text, want)
+		}
+		nu, err := tab.FindByID(u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nu.LockoutEnd == nil || !nu.LockoutEnd.Truncate(100*time.Nanosecond).Equal(u.LockoutEnd.Truncate(100*time.Nanosecond)) {
+			t.Errorf("%s: LockoutEnd read back as %v, want %v", u.UserName, nu.LockoutEnd, u.LockoutEnd)
+		}
+	})
+}
+
+func TestOpen(t *testing.T) {
+	db, err := openDB("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+	err = initDB(db, "./testdata/sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab, err := Open(db, "AspNetUsers", SQLiteDatabase)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := tab.FindByName(names[0]); err != nil {
+		t.Errorf("cannot find %v: %v", names[0], err)
+	}
+
+	// older name for LockoutEnd
+	_, err = db.Exec(`ALTER TABLE "AspNetUsers" RENAME COLUMN "LockoutEnd" TO "LockoutEndDateUtc"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab, err = Open(db, "AspNetUsers", SQLiteDatabase)
+	if err != nil {
+		t.Fatalf("Open with LockoutEndDateUtc: %v", err)
+	}
+	u, err := tab.FindByName(names[0])
+	if err != nil {
+		t.Fatalf("cannot find %v: %v", names[0], err)
+	}
+	if err := tab.LockOut(u, time.Minute); err != nil {
+		t.Errorf("%s: lock out: %v", u.UserName, err)
+	}
+
+	// the SQL uses the table's own spelling of the columns, as PostgreSQL requires
+	var ddl string
+	if err := db.QueryRow(`SELECT sql FROM sqlite_master WHERE name = 'AspNetUsers'`).Scan(&ddl); err != nil {
+		t.Fatal(err)
+	}
+	ddl = strings.Replace(strings.ToLower(ddl), `"aspnetusers"`, `"lowerusers"`, 1)
+	if _, err := db.Exec(ddl); err != nil {
+		t.Fatal(err)
+	}
+	ltab, err := Open(db, "lowerusers", SQLiteDatabase)
+	if err != nil {
+		t.Fatalf("Open with lower-case columns: %v", err)
+	}
+	list, _, err := ltab.selectQuery(Query{OrderBy: ByName, After: "A", NamePrefix: "a", EmailPrefix: "b", LockedOut: new(bool)}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{ltab.queryID, ltab.queryName, ltab.queryEmail, ltab.queryAll, ltab.insert, ltab.insertID, ltab.update, ltab.remove, ltab.queryLock, list} {
+		for i, name := range strings.Split(q, `"`) {
+			if i%2 == 1 && name != strings.ToLower(name) {
+				t.Errorf("lower-case columns: %q names %q", q, name)
+			}
+		}
+	}
+	lu, err := ltab.NewUser("rex@example.com", "rex@example.com", "REdNuIlsAnyejH3")
+	if err != nil {
+		t.Fatalf("lower-case columns: NewUser: %v", err)
+	}
+	tu, err := ltab.Track(lu.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.User.EmailConfirmed = true
+	if err := ltab.UpdateTracked(tu, true); err != nil {
+		t.Errorf("lower-case columns: UpdateTracked: %v", err)
+	}
+	if err := ltab.Delete(tu.User); err != nil {
+		t.Errorf("lower-case columns: Delete: %v", err)
+	}
+
+	_, err = Open(db, "NoSuchTable", SQLiteDatabase)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Open of missing table: want not found error, got %v", err)
+	}
+
+	// missing and mistyped columns
+	_, err = db.Exec(`CREATE TABLE "BadUsers" ("Id" TEXT NOT NULL PRIMARY KEY, "UserName" TEXT, "AccessFailedCount" BLOB)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Open(db, "BadUsers", SQLiteDatabase)
+	if err == nil {
+		t.Fatalf("Open of incompatible table succeeded")
+	}
+	for _, want := range []string{"column AccessFailedCount has unsuitable type BLOB", "missing column LockoutEnd or LockoutEndDateUtc", "missing column PasswordHash"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Open of incompatible table: error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestIdentity2(t *testing.T) {
+	db, err := openDB("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+	err = initDB(db, "./testdata/identity2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab, err := Open(db, "AspNetUsers", SQLiteDatabase)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if !tab.Identity2() {
+		t.Fatalf("Open did not recognise Identity 2 schema")
+	}
+	t.Run("IdentityUser", func(t *testing.T) {
+		testIdentityUser(t, tab)
+	})
+	t.Run("Concurrency", func(t *testing.T) {
+		u1, err := tab.FindByName(strings.ToUpper(names[1]))
+		if err != nil {
+			t.Fatalf("cannot find %v: %v", names[1], err)
+		}
+		u2, err := tab.FindByID(u1.ID)
+		if err != nil {
+			t.Fatalf("cannot find %v: %v", names[1], err)
+		}
+		if u1.ConcurrencyStamp == "" || u1.ConcurrencyStamp != u2.ConcurrencyStamp {
+			t.Fatalf("%s: inconsistent stamps %q and %q", u1.UserName, u1.ConcurrencyStamp, u2.ConcurrencyStamp)
+		}
+		if err := tab.LockOut(u1, time.Hour); err != nil {
+			t.Fatalf("%s: lock out: %v", u1.UserName, err)
+		}
+		if err := tab.ConfirmEmail(u1); err != nil {
+			t.Fatalf("%s: second update: %v", u1.UserName, err)
+		}
+		u2.PhoneNumber = "+44 1632 960000"
+		if err := tab.Update(u2); err != ErrConcurrency {
+			t.Errorf("%s: stale update: want ErrConcurrency, got %v", u2.UserName, err)
+		}
+		u3, err := tab.FindByID(u1.ID)
+		if err != nil {
+			t.Fatalf("cannot find %v: %v", names[1], err)
+		}
+		if u3.ConcurrencyStamp != u1.ConcurrencyStamp || u3.PhoneNumber != "" || !u3.EmailConfirmed || u3.LockoutEnd == nil {
+			t.Errorf("%s: unexpected state after updates: %#v", u3.UserName, u3)
+		}
+	})
+}
+
+// appUser is an application's own user type, with extra columns.
+type appUser struct {
+	User
+	FirstName string         `aspnet:"FirstName"`
+	CreatedAt *time.Time     `aspnet:"CreatedAt"`
+	TenantID  int64          `aspnet:"TenantId"`
+	Note      sql.NullString `aspnet:"Note"`
+	scratch   int            // not stored
+}
+
+func TestTable(t *testing.T) {
+	db, err := openDB("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+	err = initDB(db, "./testdata/sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = OpenTable[appUser](db, "AspNetUsers", SQLiteDatabase)
+	if err == nil || !strings.Contains(err.Error(), "missing column FirstName") {
+		t.Errorf("OpenTable without extra columns: want missing column error, got %v", err)
+	}
+	for _, col := range []string{`"FirstName" TEXT NULL`, `"CreatedAt" TEXT NULL`, `"TenantId" INTEGER NULL`, `"Note" TEXT NULL`, `"Active" INTEGER NOT NULL DEFAULT 0`} {
+		if _, err := db.Exec(`ALTER TABLE "AspNetUsers" ADD COLUMN ` + col); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tab, err := OpenTable[appUser](db, "AspNetUsers", SQLiteDatabase)
+	if err != nil {
+		t.Fatalf("OpenTable: %v", err)
+	}
+
+	u, err := tab.FindByName(names[0])
+	if err != nil {
+		t.Fatalf("cannot find %v: %v", names[0], err)
+	}
+	if u.UserName != names[0] || u.FirstName != "" || u.CreatedAt != nil || u.TenantID != 0 || u.Note.Valid {
+		t.Errorf("%s: unexpected values: %#v", names[0], u)
+	}
+
+	u, err = tab.NewUser("jakethecat@example.com", "jakethecat@example.com", "miaow")
+	if err != nil {
+		t.Fatalf("create jake: %v", err)
+	}
+	created := time.Date(2024, time.April, 29, 12, 0, 0, 0, time.UTC)
+	u.FirstName = "Jake"
+	u.CreatedAt = &created
+	u.TenantID = 42
+	u.Note = sql.NullString{String: "cat", Valid: true}
+	u.scratch = 1
+	if err := tab.Update(u); err != nil {
+		t.Fatalf("%s: update: %v", u.UserName, err)
+	}
+	if err := tab.ConfirmEmail(u); err != nil {
+		t.Fatalf("%s: confirm email: %v", u.UserName, err)
+	}
+	nu, err := tab.FindByID(u.ID)
+	if err != nil {
+		t.Fatalf("cannot find %v: %v", u.UserName, err)
+	}
+	if nu.FirstName != "Jake" || nu.CreatedAt == nil || !nu.CreatedAt.Equal(created) || nu.TenantID != 42 || nu.Note != u.Note || !nu.EmailConfirmed {
+		t.Errorf("%s: extra columns not stored: %#v", u.UserName, nu)
+	}
+
+	// fields with named types
+	type tenant string
+	type level int32
+	type flag bool
+	type namedUser struct {
+		User
+		Tenant tenant `aspnet:"FirstName"`
+		Level  level  `aspnet:"TenantId"`
+		Flag   flag   `aspnet:"Active"`
+	}
+	ntab, err := OpenTable[namedUser](db, "AspNetUsers", SQLiteDatabase)
+	if err != nil {
+		t.Fatalf("OpenTable with named types: %v", err)
+	}
+	tu, err := ntab.Track(u.ID)
+	if err != nil {
+		t.Fatalf("Track with named types: %v", err)
+	}
+	if tu.User.Tenant != "Jake" || tu.User.Level != 42 {
+		t.Errorf("named types: got %#v", tu.User)
+	}
+	tu.User.Tenant, tu.User.Level, tu.User.Flag = "Jacob", 7, true
+	if err := ntab.UpdateTracked(tu, true); err != nil {
+		t.Fatalf("UpdateTracked with named types: %v", err)
+	}
+	if fu, err := ntab.FindByID(u.ID); err != nil || fu.Tenant != "Jacob" || fu.Level != 7 || !fu.Flag {
+		t.Errorf("named types not stored: %#v (%v)", fu, err)
+	}
+
+	type badUser struct {
+		User
+		Tags []string `aspnet:"Tags"`
+	}
+	if _, err := NewTable[badUser](db, "AspNetUsers", SQLiteDatabase); err == nil {
+		t.Errorf("NewTable accepted unsupported field type")
+	}
+	type clashUser struct {
+		User
+		Mail string `aspnet:"email"`
+	}
+	if _, err := NewTable[clashUser](db, "AspNetUsers", SQLiteDatabase); err == nil {
+		t.Errorf("NewTable accepted tag naming a standard column")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	// Guid.Parse("00112233-4455-6677-8899-aabbccddeeff").ToByteArray()
+	dotnet := []byte{0x33, 0x22, 0x11, 0x00, 0x55, 0x44, 0x77, 0x66, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	b, err := GUIDKey.Arg("00112233-4455-6677-8899-aabbccddeeff")
+	if err != nil || string(b.([]byte)) != string(dotnet) {
+		t.Errorf("GUIDKey.Arg: want %x, got %x (%v)", dotnet, b, err)
+	}
+	id, err := GUIDKey.Val(dotnet)
+	if err != nil || id != "00112233-4455-6677-8899-aabbccddeeff" {
+		t.Errorf("GUIDKey.Val: want 00112233-4455-6677-8899-aabbccddeeff, got %s (%v)", id, err)
+	}
+
+	db, err := openDB("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+	for _, tt := range []struct {
+		table  string
+		idType string
+		key    *Key
+	}{
+		{"IntUsers", "INTEGER PRIMARY KEY AUTOINCREMENT", IntKey},
+		{"GuidUsers", "BLOB NOT NULL PRIMARY KEY", GUIDKey},
+	} {
+		setup, err := os.ReadFile("./testdata/sqlite/setup.sql")
+		if err != nil {
+			t.Fatal(err)
+		}
+		script := strings.ReplaceAll(string(setup), `"AspNetUsers"`, `"`+tt.table+`"`)
+		script = strings.Replace(script, `"Id" TEXT NOT NULL CONSTRAINT "PK_AspNetUsers" PRIMARY KEY`, `"Id" `+tt.idType, 1)
+		script = strings.ReplaceAll(script, `INDEX "`, `INDEX "`+tt.table)
+		if _, err := db.Exec(script); err != nil {
+			t.Fatal(err)
+		}
+		tab, err := Open(db, tt.table, SQLiteDatabase)
+		if err != nil {
+			t.Fatalf("%s: Open: %v", tt.table, err)
+		}
+		if tab.key != tt.key {
+			t.Errorf("%s: Open chose the wrong key", tt.table)
+		}
+		u, err := tab.NewUser("jake@example.com", "jake@example.com", "REdNuIlsAnyejH3")
+		if err != nil {
+			t.Fatalf("%s: create jake: %v", tt.table, err)
+		}
+		if u.ID == "" {
+			t.Fatalf("%s: no ID for new user", tt.table)
+		}
+		if err := tab.ConfirmEmail(u); err != nil {
+			t.Errorf("%s: %s: update: %v", tt.table, u.UserName, err)
+		}
+		nu, err := tab.FindByID(u.ID)
+		if err != nil {
+			t.Fatalf("%s: cannot find %s by ID %s: %v", tt.table, u.UserName, u.ID, err)
+		}
+		if *nu != *u {
+			t.Errorf("%s: FindByID: want %#v, got %#v", tt.table, u, nu)
+		}
+		if _, err := tab.FindByID("jake"); err != ErrNotFound {
+			t.Errorf("%s: FindByID of invalid key: want ErrNotFound, got %v", tt.table, err)
+		}
+		var raw any
+		if err := db.QueryRow(`SELECT "Id" FROM "` + tt.table + `"`).Scan(&raw); err != nil {
+			t.Fatal(err)
+		}
+		if want, _ := tt.key.Arg(u.ID); fmt.Sprint(raw) != fmt.Sprint(want) {
+			t.Errorf("%s: Id stored as %v, want %v", tt.table, raw, want)
+		}
+	}
+}
+
+// TestMigrateGUID checks that Open uses a Guid-keyed table as Migrate creates it.
+func TestMigrateGUID(t *testing.T) {
+	for dataType, want := range map[string]*Key{
+		"uniqueidentifier": GUIDKey, "binary(16)": GUIDKey, "bytea": GUIDKey, "BLOB": GUIDKey,
+		"uuid": GUIDTextKey, "char(36)": GUIDTextKey, "varchar(255)": StringKey, "int": IntKey,
+	} {
+		if keyFor(dataType) != want {
+			t.Errorf("keyFor(%q): wrong key", dataType)
+		}
+	}
+
+	sdb, err := openDB("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer sdb.Close()
+	mdb, err := openDB("mysql", testdb.MySQL(t))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer mdb.Close()
+	for _, tt := range []struct {
+		name  string
+		db    *sql.DB
+		style *Database
+		key   *Key
+		id    func(string) string // form of the stored Id
+	}{
+		{"SQLite", sdb, SQLiteDatabase, GUIDUpperKey, strings.ToUpper},
+		{"MySQL", mdb, MySQLDatabase, GUIDTextKey, strings.ToLower},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tab := New(tt.db, "AspNetUsers", tt.style)
+			tab.SetKey(GUIDKey)
+			if _, err := tab.Migrate(LatestSchema); err != nil {
+				t.Fatalf("Migrate: %v", err)
+			}
+			if tab.key != tt.key {
+				t.Errorf("Migrate did not change the key to the text form")
+			}
+			u, err := tab.NewUser("jake@example.com", "jake@example.com", "REdNuIlsAnyejH3")
 			if err != nil {
-				t.Fatalf("cannot find %v: %v", n, err)
+				t.Fatalf("create jake: %v", err)
+			}
+			var raw string
+			if err := tt.db.QueryRow(tt.style.cmd("SELECT", ident("Id"), "FROM", ident("AspNetUsers"))).Scan(&raw); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := uuid.Parse(raw); err != nil || raw != tt.id(raw) {
+				t.Errorf("Id stored as %q", raw)
+			}
+			otab, err := Open(tt.db, "AspNetUsers", tt.style)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if otab.key != tt.key {
+				t.Errorf("Open chose the wrong key")
+			}
+			fu, err := otab.FindByID(u.ID)
+			if err != nil || *fu != *u {
+				t.Errorf("FindByID: want %#v, got %#v (%v)", u, fu, err)
+			}
+			if _, err := otab.FindByID("jake"); err != ErrNotFound {
+				t.Errorf("FindByID of invalid key: want ErrNotFound, got %v", err)
+			}
+			if err := otab.AddPasskey(fu, Passkey{CredentialID: []byte{1, 2, 3}, Data: "{}"}); err != nil {
+				t.Errorf("AddPasskey: %v", err)
+			}
+			if err := otab.Delete(fu); err != nil {
+				t.Errorf("Delete: %v", err)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db, err := openDB("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+	history := func() []string {
+		rows, err := db.Query(`SELECT "MigrationId" FROM "__EFMigrationsHistory" ORDER BY "MigrationId"`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	tab := New(db, "AspNetUsers", SQLiteDatabase)
+	done, err := tab.Migrate(SchemaVersion1)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if len(done) == 0 {
+		t.Fatalf("Migrate: no statements executed")
+	}
+	if got := strings.Join(history(), " "); got != "00000000000000_CreateIdentitySchema" {
+		t.Errorf("history: got %s", got)
+	}
+	for _, table := range []string{"AspNetRoles", "AspNetRoleClaims", "AspNetUserClaims", "AspNetUserLogins", "AspNetUserRoles", "AspNetUserTokens"} {
+		if _, err := tableColumns(db, table, SQLiteDatabase); err != nil {
+			t.Errorf("%v", err)
+		}
+	}
+	if _, err := tableColumns(db, "AspNetUserPasskeys", SQLiteDatabase); err == nil {
+		t.Errorf("version 1 has AspNetUserPasskeys")
+	}
+	if done, err := tab.Migrate(SchemaVersion1); err != nil || len(done) != 0 {
+		t.Errorf("second Migrate: want nothing done, got %q (%v)", done, err)
+	}
+	otab, err := Open(db, "AspNetUsers", SQLiteDatabase)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	u, err := otab.NewUser("jake@example.com", "jake@example.com", "REdNuIlsAnyejH3")
+	if err != nil {
+		t.Fatalf("create jake: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO "AspNetUserClaims" ("UserId", "ClaimType", "ClaimValue") VALUES (?, 'role', 'dog')`, u.ID); err != nil {
+		t.Errorf("add claim: %v", err)
+	}
+
+	done, err = otab.Migrate(SchemaVersion3)
+	if err != nil {
+		t.Fatalf("Migrate to version 3: %v", err)
+	}
+	if len(done) != 4 {
+		// the table, its index, and two history entries
+		t.Errorf("Migrate to version 3: got %q", done)
+	}
+	if _, err := tableColumns(db, "AspNetUserPasskeys", SQLiteDatabase); err != nil {
+		t.Errorf("%v", err)
+	}
+	want := "00000000000000_CreateIdentitySchema 00000000000001_IdentitySchemaVersion2 00000000000002_IdentitySchemaVersion3"
+	if got := strings.Join(history(), " "); got != want {
+		t.Errorf("history: want %s, got %s", want, got)
+	}
+
+	// other tables follow the users table's name, and its key
+	db2, err := openDB("sqlite", filepath.Join(t.TempDir(), "users2.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db2.Close()
+	ltab := New(db2, "intusers", SQLiteDatabase)
+	ltab.SetKey(IntKey)
+	if _, err := ltab.Migrate(LatestSchema); err != nil {
+		t.Fatalf("Migrate intusers: %v", err)
+	}
+	types, err := tableColumns(db2, "aspnetuserclaims", SQLiteDatabase)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if types["UserId"] != "INTEGER" {
+		t.Errorf("aspnetuserclaims: UserId has type %s", types["UserId"])
+	}
+	u, err = ltab.NewUser("jake@example.com", "jake@example.com", "REdNuIlsAnyejH3")
+	if err != nil || u.ID != "1" {
+		t.Errorf("intusers: create jake: got ID %q (%v)", u.ID, err)
+	}
+
+	// the DDL for other dialects, as EF Core generates it
+	stab := New(nil, "dbo.AspNetUsers", SQLServerDatabase)
+	tables := identityTables(SchemaVersion2, StringKey, nil)
+	stmts := stab.createTable(&tables[0])
+	if !strings.Contains(stmts[0], "[PhoneNumber] nvarchar(256) NULL") {
+		t.Errorf("version 2 PhoneNumber: got %s", stmts[0])
+	}
+	wantIndex := "CREATE UNIQUE INDEX [UserNameIndex] ON [dbo].[AspNetUsers] ([NormalizedUserName]) WHERE [NormalizedUserName] IS NOT NULL"
+	if stmts[2] != wantIndex {
+		t.Errorf("want %s, got %s", wantIndex, stmts[2])
+	}
+	stmts = stab.createTable(&tables[6])
+	wantTokens := `CREATE TABLE [dbo].[AspNetUserTokens] (
+	[UserId] nvarchar(450) NOT NULL,
+	[LoginProvider] nvarchar(128) NOT NULL,
+	[Name] nvarchar(128) NOT NULL,
+	[Value] nvarchar(max) NULL,
+	CONSTRAINT [PK_AspNetUserTokens] PRIMARY KEY ([UserId], [LoginProvider], [Name]),
+	CONSTRAINT [FK_AspNetUserTokens_AspNetUsers_UserId] FOREIGN KEY ([UserId]) REFERENCES [dbo].[AspNetUsers] ([Id]) ON DELETE CASCADE
+)`
+	if stmts[0] != wantTokens {
+		t.Errorf("want %s, got %s", wantTokens, stmts[0])
+	}
+	if got := New(nil, "AspNetUsers", PostgresDatabase).alterColumn("AspNetUsers", ddlColumn{"PhoneNumber", tString, 256, true}); got != `ALTER TABLE "AspNetUsers" ALTER COLUMN "PhoneNumber" TYPE character varying(256)` {
+		t.Errorf("postgres: got %s", got)
+	}
+}
+
+func TestDetectSchema(t *testing.T) {
+	db, err := openDB("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+	if err := initDB(db, "./testdata/sqlite"); err != nil {
+		t.Fatalf("initDB: %v", err)
+	}
+	s, err := DetectSchema(db, "AspNetUsers", SQLiteDatabase)
+	if err != nil {
+		t.Fatalf("DetectSchema: %v", err)
+	}
+	if s.Version != SchemaVersion1 || s.Provider != "Microsoft.EntityFrameworkCore.Sqlite" || s.Migrations != nil {
+		t.Errorf("DetectSchema: got %+v", s)
+	}
+	tab, err := Open(db, "AspNetUsers", SQLiteDatabase)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	u, err := tab.FindByName(names[0])
+	if err != nil {
+		t.Fatalf("cannot find %s: %v", names[0], err)
+	}
+	if _, err := tab.Passkeys(u); err != ErrUnsupported {
+		t.Errorf("version 1 Passkeys: want ErrUnsupported, got %v", err)
+	}
+	u.PhoneNumber = strings.Repeat("1", 300)
+	if err := tab.Update(u); err != nil {
+		t.Errorf("version 1 long PhoneNumber: %v", err)
+	}
+
+	if _, err := tab.Migrate(SchemaVersion2); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := tab.Update(u); err != ErrTooLong {
+		t.Errorf("version 2 long PhoneNumber: want ErrTooLong, got %v", err)
+	}
+	s, err = DetectSchema(db, "AspNetUsers", SQLiteDatabase)
+	if err != nil || s.Version != SchemaVersion2 || len(s.Migrations) != 2 || s.ProductVersion != "8.0.0" {
+		t.Errorf("DetectSchema after Migrate: got %+v (%v)", s, err)
+	}
+
+	if _, err := tab.Migrate(SchemaVersion3); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	tab, err = Open(db, "AspNetUsers", SQLiteDatabase)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if v := tab.Schema().Version; v != SchemaVersion3 {
+		t.Fatalf("Open: want version 3, got %d", v)
+	}
+	pk := Passkey{CredentialID: []byte{1, 2, 3, 4}, Data: `{"signCount":0}`}
+	if err := tab.AddPasskey(u, pk); err != nil {
+		t.Fatalf("AddPasskey: %v", err)
+	}
+	if err := tab.AddPasskey(u, pk); err != ErrExists {
+		t.Errorf("AddPasskey again: want ErrExists, got %v", err)
+	}
+	keys, err := tab.Passkeys(u)
+	if err != nil || len(keys) != 1 || string(keys[0].CredentialID) != string(pk.CredentialID) || keys[0].Data != pk.Data {
+		t.Errorf("Passkeys: got %v (%v)", keys, err)
+	}
+	if err := tab.RemovePasskey(u, pk.CredentialID); err != nil {
+		t.Errorf("RemovePasskey: %v", err)
+	}
+	if err := tab.RemovePasskey(u, pk.CredentialID); err != ErrNotFound {
+		t.Errorf("RemovePasskey again: want ErrNotFound, got %v", err)
+	}
+
+	ldb, err := openDB("sqlite", filepath.Join(t.TempDir(), "identity2.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer ldb.Close()
+	if err := initDB(ldb, "./testdata/identity2"); err != nil {
+		t.Fatalf("initDB: %v", err)
+	}
+	s, err = DetectSchema(ldb, "AspNetUsers", SQLiteDatabase)
+	if err != nil || s.Version != SchemaIdentity2 || s.Provider != "EntityFramework" {
+		t.Errorf("DetectSchema of Identity 2: got %+v (%v)", s, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	db, err := openDB("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // SQLite has one writer
+	if err := initDB(db, "./testdata/sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	tab := New(db, "AspNetUsers", SQLiteDatabase)
+	mem := NewMemoryStore[User]()
+	rows, err := db.Query(`SELECT "UserName" FROM "AspNetUsers"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []string
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, n)
+	}
+	rows.Close()
+	for _, n := range all {
+		u, err := tab.FindByName(n)
+		if err != nil {
+			t.Fatalf("cannot find %s: %v", n, err)
+		}
+		if err := mem.Create(u); err != nil {
+			t.Fatalf("copy %s: %v", n, err)
+		}
+	}
+	t.Run("IdentityUser", func(t *testing.T) {
+		testIdentityUser(t, mem)
+	})
+}
+
+func TestList(t *testing.T) {
+	db, err := openDB("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+	tab := New(db, "AspNetUsers", SQLiteDatabase)
+	if _, err := tab.Migrate(LatestSchema); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	t.Run("SQLite", func(t *testing.T) {
+		testList(t, tab)
+	})
+
+	mdb, err := openDB("mysql", testdb.MySQL(t))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer mdb.Close()
+	mtab := New(mdb, "AspNetUsers", MySQLDatabase)
+	if _, err := mtab.Migrate(LatestSchema); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	t.Run("MySQL", func(t *testing.T) {
+		testList(t, mtab)
+	})
+
+	ldb, err := openDB("sqlite", filepath.Join(t.TempDir(), "identity2.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer ldb.Close()
+	if err := initDB(ldb, "./testdata/identity2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ldb.Exec(`DELETE FROM "AspNetUsers"`); err != nil {
+		t.Fatal(err)
+	}
+	ltab, err := Open(ldb, "AspNetUsers", SQLiteDatabase)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Run("Identity2", func(t *testing.T) {
+		testList(t, ltab)
+	})
+
+	// SQL Server has its own syntax for LIMIT
+	q, args, err := New(nil, "dbo.AspNetUsers", SQLServerDatabase).selectQuery(Query{OrderBy: ByName, After: "JAKE@EXAMPLE.COM", Limit: 10, NamePrefix: "j[a]_"}, time.Now())
+	want := "WHERE [NormalizedUserName] > @p1 AND [NormalizedUserName] LIKE @p2 ESCAPE '!' ORDER BY [NormalizedUserName] OFFSET 0 ROWS FETCH NEXT 10 ROWS ONLY"
+	if err != nil || !strings.HasSuffix(q, want) || len(args) != 2 || args[1] != "J![A]!_%" {
+		t.Errorf("SQL Server query: want %q with pattern J![A]!_%%, got %q %v (%v)", want, q, args, err)
+	}
+}
+
+// testList checks List and Select on an empty table.
+func testList(t *testing.T, tab *Users) {
+	var all []*User
+	for i := 0; i < 7; i++ {
+		name := fmt.Sprintf("User%d@example.com", i)
+		u, err := tab.NewUser(name, strings.ToLower(name), "REdNuIlsAnyejH3")
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		u.EmailConfirmed = i%2 == 0
+		u.TwoFactorEnabled = i == 3
+		u.LockoutEnabled = i >= 5
+		if i == 6 {
+			past := time.Now().Add(-time.Hour)
+			u.LockoutEnd = &past
+		}
+		if err := tab.Update(u); err != nil {
+			t.Fatalf("update %s: %v", name, err)
+		}
+		if i == 5 {
+			if err := tab.LockOut(u, time.Hour); err != nil {
+				t.Fatalf("lock out %s: %v", name, err)
+			}
+		}
+		all = append(all, u)
+	}
+	// every user just once, a page at a time, in order
+	for _, order := range []Order{ByID, ByName} {
+		key := func(u *User) string {
+			if order == ByName {
+				return Normalize(u.UserName)
+			}
+			return u.ID
+		}
+		var got []string
+		q := Query{OrderBy: order, Limit: 4}
+		for pages := 0; ; pages++ {
+			if pages > len(all) {
+				t.Fatalf("order %d: too many pages", order)
 			}
-			//fmt.Printf("found %s: %#v\n", n, u)
-			nu, err := tab.FindByID(u.ID)
+			page, err := tab.List(q)
 			if err != nil {
-				t.Fatalf("cannot find %v by Id %v: %v", n, u.ID, err)
+				t.Fatalf("order %d: List: %v", order, err)
+			}
+			if len(page.Users) > q.Limit {
+				t.Errorf("order %d: page of %d users, limit %d", order, len(page.Users), q.Limit)
 			}
-			if *nu != *u && nu.LockoutEnd == nil && u.LockoutEnd == nil {
-				t.Fatalf("ByID doesn't match ByName: %v", n)
+			for _, u := range page.Users {
+				got = append(got, key(u))
 			}
+			if page.Next == "" {
+				break
+			}
+			q.After = page.Next
+		}
+		var want []string
+		for _, u := range all {
+			want = append(want, key(u))
 		}
+		sort.Strings(want)
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("order %d: want %v, got %v", order, want, got)
+		}
+	}
 
-		u, err := tab.NewUser("jakethedog@example.com", "jakethedog@example.com", "woofy")
+	// LIKE's special characters are matched literally (the collations disagree on their order)
+	for _, name := range []string{"special_%@example.com", "specialXY@example.com"} {
+		u, err := tab.NewUser(name, name, "REdNuIlsAnyejH3")
 		if err != nil {
-			t.Errorf("create jake: %v", err)
+			t.Fatalf("create %s: %v", name, err)
 		}
+		all = append(all, u)
+	}
 
-		// check duplicate create
-		ud, err := tab.NewUser("jakethedog@example.com", "jakethedog@example.com", "waffy")
-		if err == nil {
-			t.Errorf("duplicate jake was allowed: %v\n\t%#v", u, ud)
-		} else if !errors.Is(err, ErrExists) {
-			t.Errorf("wrong error for duplicate: want %v, got %v", ErrExists, err)
+	yes, no := true, false
+	for _, tt := range []struct {
+		q    Query
+		want []int // indexes in all
+	}{
+		{Query{EmailConfirmed: &yes}, []int{0, 2, 4, 6}},
+		{Query{EmailConfirmed: &no, NamePrefix: "user"}, []int{1, 3, 5}},
+		{Query{TwoFactorEnabled: &yes}, []int{3}},
+		{Query{LockedOut: &yes}, []int{5}},
+		{Query{LockedOut: &no, NamePrefix: "USER"}, []int{0, 1, 2, 3, 4, 6}},
+		{Query{EmailPrefix: "user1@"}, []int{1}},
+		{Query{NamePrefix: "special_%"}, []int{7}},
+		{Query{NamePrefix: "special"}, []int{7, 8}},
+		{Query{NamePrefix: "nobody"}, nil},
+	} {
+		page, err := tab.List(tt.q)
+		if err != nil {
+			t.Errorf("%+v: List: %v", tt.q, err)
+			continue
+		}
+		var got, want []string
+		for _, u := range page.Users {
+			got = append(got, u.UserName)
 		}
+		for _, i := range tt.want {
+			want = append(want, all[i].UserName)
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("%+v: want %v, got %v", tt.q, want, got)
+		}
+	}
+
+	// Select streams, and stops at an error
+	stop := errors.New("stop")
+	n := 0
+	err := tab.Select(Query{}, func(u *User) error {
+		n++
+		if n == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 3 {
+		t.Errorf("Select: want to stop at the third user, got %v after %d", err, n)
+	}
+}
 
-		// check update of several fields
-		u.AccessFailedCount = 1
-		err = tab.Update(u)
+func TestDelete(t *testing.T) {
+	db, err := openDB("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+	tab := New(db, "AspNetUsers", SQLiteDatabase)
+	if _, err := tab.Migrate(LatestSchema); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	var users []*User
+	for _, name := range []string{"rex@example.com", "spot@example.com"} {
+		u, err := tab.NewUser(name, name, "REdNuIlsAnyejH3")
 		if err != nil {
-			t.Errorf("%s: %v", u.UserName, err)
+			t.Fatalf("create %s: %v", name, err)
+		}
+		users = append(users, u)
+	}
+	if _, err := db.Exec(`INSERT INTO "AspNetRoles" ("Id", "Name", "NormalizedName") VALUES ('r1', 'Admin', 'ADMIN')`); err != nil {
+		t.Fatal(err)
+	}
+	for i, u := range users {
+		for _, stmt := range []string{
+			`INSERT INTO "AspNetUserRoles" ("UserId", "RoleId") VALUES (?, 'r1')`,
+			`INSERT INTO "AspNetUserClaims" ("UserId", "ClaimType", "ClaimValue") VALUES (?, 'role', 'admin')`,
+			`INSERT INTO "AspNetUserLogins" ("UserId", "LoginProvider", "ProviderKey") VALUES (?, 'Google', '` + u.ID + `')`,
+			`INSERT INTO "AspNetUserTokens" ("UserId", "LoginProvider", "Name", "Value") VALUES (?, 'Google', 'access_token', 'xyzzy')`,
+		} {
+			if _, err := db.Exec(stmt, u.ID); err != nil {
+				t.Fatalf("%s: %v", stmt, err)
+			}
+		}
+		if err := tab.AddPasskey(u, Passkey{CredentialID: []byte{byte(i), 1, 2, 3}, Data: "{}"}); err != nil {
+			t.Fatalf("AddPasskey: %v", err)
+		}
+	}
+	// rows is the number of rows the user has in each related table, or -1 on error
+	rows := func(u *User) []int {
+		var counts []int
+		for _, table := range userTables {
+			var n int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM "`+table+`" WHERE "UserId" = ?`, u.ID).Scan(&n); err != nil {
+				t.Errorf("%s: %v", table, err)
+				n = -1
+			}
+			counts = append(counts, n)
 		}
+		return counts
+	}
+
+	u := users[0]
+	stale := *u
+	if err := tab.ConfirmEmail(u); err != nil {
+		t.Fatal(err)
+	}
+	if err := tab.Delete(&stale); err != ErrConcurrency {
+		t.Errorf("Delete of stale copy: want ErrConcurrency, got %v", err)
+	}
+	if got := rows(u); fmt.Sprint(got) != "[1 1 1 1 1]" {
+		t.Errorf("related rows after failed Delete: want one in each, got %v", got)
+	}
+	// the stamp is checked before any related row is touched
+	if _, err := db.Exec(`CREATE TRIGGER "NoClaimDelete" BEFORE DELETE ON "AspNetUserClaims" BEGIN SELECT RAISE(ABORT, 'claim deleted'); END`); err != nil {
+		t.Fatal(err)
+	}
+	if err := tab.Delete(&stale); err != ErrConcurrency {
+		t.Errorf("Delete of stale copy, with related rows guarded: want ErrConcurrency, got %v", err)
+	}
+	if _, err := db.Exec(`DROP TRIGGER "NoClaimDelete"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := tab.Delete(u); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	// found once, and kept for later calls
+	if !tab.relatedOK || len(tab.related) != len(userTables) {
+		t.Errorf("related tables after Delete: want all %d, got %v", len(userTables), tab.related)
+	}
+	if otab, err := Open(db, "AspNetUsers", SQLiteDatabase); err != nil {
+		t.Errorf("Open: %v", err)
+	} else if !otab.relatedOK || len(otab.related) != len(userTables) {
+		t.Errorf("related tables after Open: want all %d, got %v", len(userTables), otab.related)
+	}
+	if _, err := tab.FindByID(u.ID); err != ErrNotFound {
+		t.Errorf("FindByID after Delete: want ErrNotFound, got %v", err)
+	}
+	if got := rows(u); fmt.Sprint(got) != "[0 0 0 0 0]" {
+		t.Errorf("related rows after Delete: want none, got %v", got)
+	}
+	if got := rows(users[1]); fmt.Sprint(got) != "[1 1 1 1 1]" {
+		t.Errorf("other user's related rows after Delete: want one in each, got %v", got)
+	}
+	if err := tab.Delete(u); err != ErrConcurrency {
+		t.Errorf("second Delete: want ErrConcurrency, got %v", err)
+	}
+
+	// with just the users table, and the Identity 2 schema
+	ldb, err := openDB("sqlite", filepath.Join(t.TempDir(), "identity2.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer ldb.Close()
+	if err := initDB(ldb, "./testdata/identity2"); err != nil {
+		t.Fatal(err)
+	}
+	ltab, err := Open(ldb, "AspNetUsers", SQLiteDatabase)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	lu, err := ltab.FindByName(names[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale = *lu
+	if err := ltab.LockOut(lu, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := ltab.Delete(&stale); err != ErrConcurrency {
+		t.Errorf("Identity 2: Delete of stale copy: want ErrConcurrency, got %v", err)
+	}
+	if err := ltab.Delete(lu); err != nil {
+		t.Fatalf("Identity 2: Delete: %v", err)
+	}
+	if _, err := ltab.FindByName(names[1]); err != ErrNotFound {
+		t.Errorf("Identity 2: FindByName after Delete: want ErrNotFound, got %v", err)
+	}
+}
+
+func TestUpdateTracked(t *testing.T) {
+	db, err := openDB("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+	tab := New(db, "AspNetUsers", SQLiteDatabase)
+	if _, err := tab.Migrate(LatestSchema); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	t.Run("SQLite", func(t *testing.T) {
+		testUpdateTracked(t, tab)
+	})
+
+	mdb, err := openDB("mysql", testdb.MySQL(t))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer mdb.Close()
+	mtab := New(mdb, "AspNetUsers", MySQLDatabase)
+	if _, err := mtab.Migrate(LatestSchema); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	t.Run("MySQL", func(t *testing.T) {
+		testUpdateTracked(t, mtab)
+	})
+
+	ldb, err := openDB("sqlite", filepath.Join(t.TempDir(), "identity2.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer ldb.Close()
+	if err := initDB(ldb, "./testdata/identity2"); err != nil {
+		t.Fatal(err)
+	}
+	ltab, err := Open(ldb, "AspNetUsers", SQLiteDatabase)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Run("Identity2", func(t *testing.T) {
+		testUpdateTracked(t, ltab)
+	})
+}
 
-		// password change
-		ostamp := u.SecurityStamp
-		err = tab.ChangePassword(u, "hey there!")
+// testUpdateTracked checks UpdateTracked against changes made meanwhile by another process, using Update.
+func testUpdateTracked(t *testing.T, tab *Users) {
+	u, err := tab.NewUser("Rex@example.com", "rex@example.com", "REdNuIlsAnyejH3")
+	if err != nil {
+		t.Fatalf("create rex: %v", err)
+	}
+	other := func(change func(u *User)) *User {
+		ou, err := tab.FindByID(u.ID)
 		if err != nil {
-			t.Errorf("%s: password change failed: %v", u.UserName, err)
-		} else {
-			t.Logf("%s: security stamp after pw change: before %s after %s", u.UserName, ostamp, u.SecurityStamp)
+			t.Fatal(err)
 		}
+		change(ou)
+		if err := tab.Update(ou); err != nil {
+			t.Fatalf("other update: %v", err)
+		}
+		return ou
+	}
+	tu, err := tab.Track(u.ID)
+	if err != nil {
+		t.Fatalf("Track: %v", err)
+	}
 
-		// check authentication
-		for _, user := range testusers {
-			u, err := tab.Authenticate(user.name, user.pw)
-			if err != nil {
-				t.Errorf("%s: want error nil; got %v", user.name, err)
-				continue
+	// no change, no write
+	if err := tab.UpdateTracked(tu, true); err != nil || tu.User.ConcurrencyStamp != u.ConcurrencyStamp {
+		t.Errorf("UpdateTracked without change: got stamp %q, want %q (%v)", tu.User.ConcurrencyStamp, u.ConcurrencyStamp, err)
+	}
+
+	// a change to another column is kept, and the other process's copy remains current
+	ou := other(func(u *User) { u.PhoneNumber = "+441632960000" })
+	tu.User.AccessFailedCount = 3
+	if err := tab.UpdateTracked(tu, false); err != nil {
+		t.Fatalf("UpdateTracked after other change: %v", err)
+	}
+	fu, err := tab.FindByID(u.ID)
+	if err != nil || fu.AccessFailedCount != 3 || fu.PhoneNumber != "+441632960000" || *fu != *tu.User {
+		t.Errorf("after UpdateTracked: want %#v, got %#v (%v)", tu.User, fu, err)
+	}
+	if !tab.Identity2() && fu.ConcurrencyStamp != ou.ConcurrencyStamp {
+		t.Errorf("UpdateTracked without checkStamp changed the ConcurrencyStamp")
+	}
+	ou.EmailConfirmed = true
+	if err := tab.Update(ou); err != nil && !tab.Identity2() {
+		// in Identity 2, the stamp is a digest of the row, so any change makes a copy stale
+		t.Errorf("update of other copy after UpdateTracked: %v", err)
+	}
+
+	// a change to the same column clashes
+	tu, err = tab.Track(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other(func(u *User) { u.PhoneNumber = "+441632960001"; u.LockoutEnabled = !u.LockoutEnabled })
+	tu.User.PhoneNumber = "+441632960002"
+	err = tab.UpdateTracked(tu, false)
+	var ce *ConflictError
+	if !errors.As(err, &ce) || fmt.Sprint(ce.Fields) != "[PhoneNumber]" || !errors.Is(err, ErrConcurrency) {
+		t.Errorf("UpdateTracked of column changed by other: want conflict in PhoneNumber, got %v", err)
+	}
+	if fu, _ := tab.FindByID(u.ID); fu.PhoneNumber != "+441632960001" {
+		t.Errorf("conflicting UpdateTracked was stored: %q", fu.PhoneNumber)
+	}
+
+	// with checkStamp, any change clashes, and the stamp changes
+	tu, err = tab.Track(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other(func(u *User) { u.TwoFactorEnabled = true })
+	tu.User.AccessFailedCount = 5
+	err = tab.UpdateTracked(tu, true)
+	if !errors.As(err, &ce) || fmt.Sprint(ce.Fields) != "[TwoFactorEnabled]" {
+		t.Errorf("UpdateTracked with checkStamp after other change: want conflict in TwoFactorEnabled, got %v", err)
+	}
+	tu, err = tab.Track(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamp := tu.User.ConcurrencyStamp
+	tu.User.AccessFailedCount = 5
+	if err := tab.UpdateTracked(tu, true); err != nil || tu.User.ConcurrencyStamp == stamp || tu.User.AccessFailedCount != 5 || !tu.User.TwoFactorEnabled {
+		t.Errorf("UpdateTracked with checkStamp: got %#v (%v)", tu.User, err)
+	}
+
+	// a change made in place to the time of LockoutEnd
+	end := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	tu.User.LockoutEnd = &end
+	if err := tab.UpdateTracked(tu, false); err != nil {
+		t.Fatalf("UpdateTracked of LockoutEnd: %v", err)
+	}
+	*tu.User.LockoutEnd = end.Add(time.Hour)
+	if err := tab.UpdateTracked(tu, false); err != nil {
+		t.Fatalf("UpdateTracked of LockoutEnd changed in place: %v", err)
+	}
+	if fu, err := tab.FindByID(u.ID); err != nil || fu.LockoutEnd == nil || !fu.LockoutEnd.Equal(end.Add(time.Hour)) {
+		t.Errorf("LockoutEnd changed in place was not stored: got %v (%v)", fu.LockoutEnd, err)
+	}
+
+	// a removed user
+	if err := tab.Delete(tu.User); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	tu.User.AccessFailedCount = 1
+	if err := tab.UpdateTracked(tu, false); err != ErrConcurrency {
+		t.Errorf("UpdateTracked of removed user: want exactly ErrConcurrency, got %v", err)
+	}
+}
+
+// clashStore is a MemoryStore in which another process changes the user, by a failed login,
+// just before each of the first clashes calls of Update.
+type clashStore struct {
+	*MemoryUsers
+	clashes int
+}
+
+func (s *clashStore) Update(u *User) error {
+	if s.clashes > 0 {
+		s.clashes--
+		other, err := s.MemoryUsers.FindByID(u.ID)
+		if err == nil {
+			other.AccessFailedCount++
+			if err := s.MemoryUsers.Update(other); err != nil {
+				return err
+			}
+		}
+	}
+	return s.MemoryUsers.Update(u)
+}
+
+func TestUpdateFunc(t *testing.T) {
+	s := &clashStore{MemoryUsers: NewMemoryStore[User]()}
+	u, err := NewUser(s, "Jake@example.com", "jake@example.com", "woofy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	s.clashes = 2
+	nu, err := UpdateFunc[User](s, u.ID, func(u *User) error {
+		calls++
+		u.PhoneNumber = "+441632960000"
+		return nil
+	})
+	if err != nil || calls != 3 || nu.PhoneNumber != "+441632960000" || nu.AccessFailedCount != 2 {
+		t.Errorf("UpdateFunc after 2 clashes: got %d calls, %#v (%v)", calls, nu, err)
+	}
+
+	s.clashes = maxUpdateAttempts
+	if _, err := UpdateFunc[User](s, u.ID, func(*User) error { return nil }); err != ErrConcurrency {
+		t.Errorf("UpdateFunc with endless clashes: want ErrConcurrency, got %v", err)
+	}
+	s.clashes = 0
+
+	bad := errors.New("no change")
+	if _, err := UpdateFunc[User](s, u.ID, func(u *User) error { u.PhoneNumber = ""; return bad }); err != bad {
+		t.Errorf("UpdateFunc with failing mutate: want %v, got %v", bad, err)
+	}
+	if fu, _ := s.FindByID(u.ID); fu.PhoneNumber != "+441632960000" {
+		t.Errorf("failing mutate was stored: %#v", fu)
+	}
+	if _, err := UpdateFunc[User](s, newStamp(), func(*User) error { return nil }); err != ErrNotFound {
+		t.Errorf("UpdateFunc of unknown user: want ErrNotFound, got %v", err)
+	}
+
+	// the operations on a user retry with the stored user, if u is stale (as it now is)
+	if err := ConfirmEmail(s, u); err != nil || !u.EmailConfirmed || u.PhoneNumber != "+441632960000" {
+		t.Errorf("ConfirmEmail of stale user: got %#v (%v)", u, err)
+	}
+	s.clashes = 1
+	if err := LockOut(s, u, time.Hour); err != nil || u.LockoutEnd == nil || !u.EmailConfirmed {
+		t.Errorf("LockOut with clash: got %#v (%v)", u, err)
+	}
+	s.clashes = 1
+	if err := ResetLockout(s, u); err != nil || u.LockoutEnd != nil {
+		t.Errorf("ResetLockout with clash: got %#v (%v)", u, err)
+	}
+
+	// failed logins counted by another process are kept
+	s.clashes = 1
+	failed := u.AccessFailedCount
+	if _, err := Authenticate(s, "jake@example.com", "waffy"); err != ErrInvalidCredentials {
+		t.Errorf("Authenticate with wrong password: want ErrInvalidCredentials, got %v", err)
+	}
+	if fu, _ := s.FindByID(u.ID); fu.AccessFailedCount != failed+2 {
+		t.Errorf("AccessFailedCount after clashing failure: want %d, got %d", failed+2, fu.AccessFailedCount)
+	}
+}
+
+// countStore is a MemoryStore that counts the calls of Update.
+type countStore struct {
+	*MemoryUsers
+	updates int
+}
+
+func (s *countStore) Update(u *User) error {
+	s.updates++
+	return s.MemoryUsers.Update(u)
+}
+
+func TestAuthenticateWrites(t *testing.T) {
+	s := &countStore{MemoryUsers: NewMemoryStore[User]()}
+	if _, err := NewUser(s, "Jake@example.com", "jake@example.com", "woofy"); err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range []struct {
+		password string
+		updates  int
+		failed   int
+	}{
+		{"woofy", 0, 0},
+		{"woofy", 0, 0},
+		{"waffy", 1, 1},
+		{"waffy", 2, 2},
+		{"woofy", 3, 0},
+		{"woofy", 3, 0},
+	} {
+		Authenticate(s, "jake@example.com", tt.password)
+		fu, err := s.FindByName("jake@example.com")
+		if err != nil || s.updates != tt.updates || fu.AccessFailedCount != tt.failed {
+			t.Errorf("%d: want %d updates and count %d, got %d and %d (%v)", i, tt.updates, tt.failed, s.updates, fu.AccessFailedCount, err)
+		}
+	}
+	if u, err := Authenticate(s, "nobody@example.com", ""); err != ErrInvalidCredentials {
+		t.Errorf("Authenticate of unknown user with empty password: want ErrInvalidCredentials, got %#v (%v)", u, err)
+	}
+
+	// a Table without failure tracking never writes
+	db, err := openDB("sqlite", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+	tab := New(db, "AspNetUsers", SQLiteDatabase)
+	if _, err := tab.Migrate(LatestSchema); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	u, err := tab.NewUser("Jake@example.com", "jake@example.com", "woofy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab.SetTrackFailures(false)
+	if tab.TrackFailures() {
+		t.Errorf("TrackFailures after SetTrackFailures(false)")
+	}
+	if _, err := tab.Authenticate("jake@example.com", "waffy"); err != ErrInvalidCredentials {
+		t.Errorf("Authenticate with wrong password: want ErrInvalidCredentials, got %v", err)
+	}
+	if _, err := tab.SignIn("jake@example.com", "woofy"); err != nil {
+		t.Errorf("SignIn: %v", err)
+	}
+	if fu, err := tab.FindByID(u.ID); err != nil || *fu != *u {
+		t.Errorf("user changed without failure tracking: want %#v, got %#v (%v)", u, fu, err)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		style *Database
+		table string
+		want  string
+	}{
+		{MySQLDatabase, "aspnetusers", "SELECT `Id` FROM `aspnetusers` WHERE `Id` = ?"},
+		{PostgresDatabase, "public.AspNetUsers", `SELECT "Id" FROM "public"."AspNetUsers" WHERE "Id" = $1`},
+		{SQLServerDatabase, "dbo.AspNetUsers", "SELECT [Id] FROM [dbo].[AspNetUsers] WHERE [Id] = @p1"},
+	}
+	for _, tt := range tests {
+		got := tt.style.cmd("SELECT", ident("Id"), "FROM", ident(tt.table), "WHERE", ident("Id"), "=", tt.style.Param(1))
+		if got != tt.want {
+			t.Errorf("%s: want %q, got %q", tt.table, tt.want, got)
+		}
+	}
+
+	// SQL Server locks the row read by a table hint
+	tab := New(nil, "dbo.AspNetUsers", SQLServerDatabase)
+	if want := "FROM [dbo].[AspNetUsers] WITH (UPDLOCK, ROWLOCK) WHERE [Id] = @p1"; !strings.Contains(tab.queryLock, want) {
+		t.Errorf("SQL Server: locking query %q lacks %q", tab.queryLock, want)
+	}
+}
+
+func TestLockoutEndZones(t *testing.T) {
+	end := time.Date(2024, time.April, 29, 23, 30, 15, 123456700, time.UTC)
+	zones := []*time.Location{
+		time.UTC,
+		time.FixedZone("EST", -5*60*60),
+		time.FixedZone("IST", 5*60*60+30*60),
+		time.FixedZone("CHADT", 13*60*60+45*60),
+	}
+	for _, loc := range zones {
+		local := end.In(loc)
+
+		// MySQL datetime is written as UTC text, and read back from the driver's time in its loc
+		if got, want := MySQLDatabase.timeArg(&local), "2024-04-29 23:30:15.123456"; got != want {
+			t.Errorf("%s: MySQL TimeArg: want %q, got %q", loc, want, got)
+		}
+		wall := time.Date(end.Year(), end.Month(), end.Day(), end.Hour(), end.Minute(), end.Second(), end.Nanosecond(), loc)
+		got, err := MySQLDatabase.timeVal(wall)
+		if err != nil || !got.Equal(end) || got.Location() != time.UTC {
+			t.Errorf("%s: MySQL TimeVal: want %v, got %v (%v)", loc, end, got, err)
+		}
+
+		// datetimeoffset and timestamptz carry an offset
+		for _, style := range []*Database{PostgresDatabase, SQLServerDatabase} {
+			got, err := style.timeVal(local)
+			if err != nil || !got.Equal(end) || got.Location() != time.UTC {
+				t.Errorf("%s: TimeVal: want %v, got %v (%v)", loc, end, got, err)
 			}
-			if u.UserName != user.name {
-				t.Errorf("%s: mismatched name for Authenticate: %s", user.name, u.UserName)
+			if arg := style.timeArg(&local).(*time.Time); !arg.Equal(end) || arg.Location() != time.UTC {
+				t.Errorf("%s: TimeArg: want %v, got %v", loc, end, arg)
 			}
-			if u.PasswordHash != user.b64 {
-				t.Errorf("%s: mismatched hashed pw: %v got %v", user.name, user.b64, u.PasswordHash)
+		}
+
+		// SQLite stores DateTimeOffset text, written with offset zero
+		text := SQLiteDatabase.timeArg(&local)
+		if want := "2024-04-29 23:30:15.1234567+00:00"; text != want {
+			t.Errorf("%s: SQLite TimeArg: want %q, got %q", loc, want, text)
+		}
+		got, err = SQLiteDatabase.timeVal(local.Format("2006-01-02 15:04:05.9999999-07:00"))
+		if err != nil || !got.Equal(end) || got.Location() != time.UTC {
+			t.Errorf("%s: SQLite TimeVal: want %v, got %v (%v)", loc, end, got, err)
+		}
+	}
+
+	// without parseTime, the MySQL driver returns text
+	_, err := MySQLDatabase.timeVal([]uint8("2024-04-29 23:30:15.123456"))
+	if err == nil {
+		t.Errorf("MySQL TimeVal accepted text without parseTime")
+	}
+
+	// an extra time column is converted as LockoutEnd is, and its errors name it
+	extras, err := extraColumns[appUser]()
+	if err != nil {
+		t.Fatalf("extraColumns: %v", err)
+	}
+	for _, c := range extras {
+		if c.name != "CreatedAt" {
+			continue
+		}
+		var u appUser
+		var v any = time.Date(end.Year(), end.Month(), end.Day(), end.Hour(), end.Minute(), end.Second(), end.Nanosecond(), zones[1])
+		if err := c.set(MySQLDatabase, &u, &v); err != nil || !u.CreatedAt.Equal(end) || u.CreatedAt.Location() != time.UTC {
+			t.Errorf("MySQL CreatedAt: want %v, got %v (%v)", end, u.CreatedAt, err)
+		}
+		for _, style := range []*Database{MySQLDatabase, SQLiteDatabase} {
+			v = []uint8("yesterday")
+			err := c.set(style, &u, &v)
+			if err == nil || !strings.Contains(err.Error(), "CreatedAt") || strings.Contains(err.Error(), "LockoutEnd") {
+				t.Errorf("%s: bad CreatedAt: want an error naming CreatedAt, got %v", style.Dialect, err)
 			}
-			_, err = tab.Authenticate(user.name, "")
-			if err == nil {
-				t.Errorf("%s: accepted incorrect password", user.name)
+		}
+	}
+}
+
+// testIdentityUser checks the operations on a store holding the users in data.sql.
+func testIdentityUser(t *testing.T, s UserStore) {
+	for _, n := range names {
+		u, err := s.FindByName(n)
+		if err != nil {
+			t.Fatalf("cannot find %v: %v", n, err)
+		}
+		//fmt.Printf("found %s: %#v\n", n, u)
+		nu, err := s.FindByID(u.ID)
+		if err != nil {
+			t.Fatalf("cannot find %v by Id %v: %v", n, u.ID, err)
+		}
+		if *nu != *u && nu.LockoutEnd == nil && u.LockoutEnd == nil {
+			t.Fatalf("ByID doesn't match ByName: %v", n)
+		}
+	}
+	if ef, ok := s.(EmailFinder[*User]); ok {
+		for _, n := range names {
+			u, err := s.FindByName(n)
+			if err != nil {
+				t.Fatalf("cannot find %v: %v", n, err)
 			}
-			if err != ErrInvalidCredentials {
-				t.Errorf("%s: want ErrInvalidCredentials, got %#v", user.name, err)
+			eu, err := FindByEmail(ef, u.Email)
+			if err != nil || eu.ID != u.ID {
+				t.Errorf("%s: FindByEmail(%q): got %v (%v)", n, u.Email, eu, err)
 			}
 		}
-	})
+	}
+
+	u, err := NewUser(s, "jakethedog@example.com", "jakethedog@example.com", "woofy")
+	if err != nil {
+		t.Errorf("create jake: %v", err)
+	}
+
+	// check duplicate create
+	ud, err := NewUser(s, "jakethedog@example.com", "jakethedog@example.com", "waffy")
+	if err == nil {
+		t.Errorf("duplicate jake was allowed: %v\n\t%#v", u, ud)
+	} else if !errors.Is(err, ErrExists) {
+		t.Errorf("wrong error for duplicate: want %v, got %v", ErrExists, err)
+	}
+
+	// Create keeps a given ID
+	id := newStamp()
+	cu := &User{ID: id, UserName: "Fido@example.com", NormalizedUserName: Normalize("Fido@example.com"), SecurityStamp: newStamp(), ConcurrencyStamp: newStamp()}
+	if err := s.Create(cu); err != nil {
+		t.Errorf("create fido: %v", err)
+	} else if fu, err := s.FindByID(id); err != nil || fu.UserName != cu.UserName {
+		t.Errorf("find fido by ID %s: got %v (%v)", id, fu, err)
+	}
+	if err := s.Create(&User{ID: newStamp(), UserName: "FIDO@example.com", NormalizedUserName: Normalize("FIDO@example.com")}); err != ErrExists {
+		t.Errorf("create duplicate fido: want ErrExists, got %v", err)
+	}
+
+	// check update of several fields
+	u.AccessFailedCount = 1
+	err = s.Update(u)
+	if err != nil {
+		t.Errorf("%s: %v", u.UserName, err)
+	}
+
+	// setters keep the derived fields consistent, and Update insists on that
+	if err := SetEmail(s, u, "Jake.The.Dog@example.com"); err != nil {
+		t.Errorf("%s: SetEmail: %v", u.UserName, err)
+	} else if eu, err := s.FindByID(u.ID); err != nil || eu.NormalizedEmail != "JAKE.THE.DOG@EXAMPLE.COM" || eu.EmailConfirmed {
+		t.Errorf("%s: after SetEmail: got %v (%v)", u.UserName, eu, err)
+	}
+	bad := *u
+	bad.Email = "jake@example.com"
+	if err := s.Update(&bad); err != ErrNotNormalized {
+		t.Errorf("%s: Update with stale NormalizedEmail: want ErrNotNormalized, got %v", u.UserName, err)
+	}
+
+	// password change
+	ostamp := u.SecurityStamp
+	err = ChangePassword(s, u, "hey there!")
+	if err != nil {
+		t.Errorf("%s: password change failed: %v", u.UserName, err)
+	} else {
+		t.Logf("%s: security stamp after pw change: before %s after %s", u.UserName, ostamp, u.SecurityStamp)
+	}
+
+	// check authentication
+	for _, user := range testusers {
+		u, err := Authenticate(s, user.name, user.pw)
+		if err != nil {
+			t.Errorf("%s: want error nil; got %v", user.name, err)
+			continue
+		}
+		if u.UserName != user.name {
+			t.Errorf("%s: mismatched name for Authenticate: %s", user.name, u.UserName)
+		}
+		if u.PasswordHash != user.b64 {
+			t.Errorf("%s: mismatched hashed pw: %v got %v", user.name, user.b64, u.PasswordHash)
+		}
+		_, err = Authenticate(s, user.name, "")
+		if err == nil {
+			t.Errorf("%s: accepted incorrect password", user.name)
+		}
+		if err != ErrInvalidCredentials {
+			t.Errorf("%s: want ErrInvalidCredentials, got %#v", user.name, err)
+		}
+	}
 }
 
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
+func openDB(driver, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -127,9 +1644,9 @@ func openDB(dsn string) (*sql.DB, error) {
 	return db, nil
 }
 
-func initDB(db *sql.DB) error {
+func initDB(db *sql.DB, dir string) error {
 
-	script, err := os.ReadFile("./testdata/setup.sql")
+	script, err := os.ReadFile(dir + "/setup.sql")
 	if err != nil {
 		return err
 	}
@@ -138,7 +1655,7 @@ func initDB(db *sql.DB) error {
 		return err
 	}
 
-	script, err = os.ReadFile("./testdata/data.sql")
+	script, err = os.ReadFile(dir + "/data.sql")
 	if err != nil {
 		return err
 	}